@@ -3,6 +3,7 @@ import { Button } from '@/components/ui/button'
 import { useAuthStore } from '@/lib/auth'
 import { Moon, Sun } from 'lucide-react'
 import { useTheme } from '@/lib/theme'
+import { Inbox } from '@/components/notifications/inbox'
 
 export default function Header() {
   const { isAuthenticated, logout } = useAuthStore()
@@ -29,6 +30,7 @@ export default function Header() {
             <Moon className="h-5 w-5" />
           )}
         </Button>
+        {isAuthenticated && <Inbox />}
         {isAuthenticated && (
           <Button variant="ghost" onClick={logout}>
             Logout
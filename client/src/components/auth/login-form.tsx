@@ -1,7 +1,9 @@
+import { useState } from 'react'
 import { useForm } from 'react-hook-form'
 import { zodResolver } from '@hookform/resolvers/zod'
 import * as z from 'zod'
-import { useAuthStore } from '@/lib/auth'
+import { apiFetch, useAuthStore } from '@/lib/auth'
+import type { LoginResult } from '@/lib/auth'
 import { Button } from '@/components/ui/button'
 import {
   Form,
@@ -19,8 +21,15 @@ const formSchema = z.object({
   password: z.string().min(8),
 })
 
+// A six digit code from the authenticator app, or a recovery code such as
+// abcde-fghij
+const mfaSchema = z.object({
+  code: z.string().trim().min(6).max(11),
+})
+
 export function LoginForm() {
   const { login } = useAuthStore()
+  const [mfaToken, setMfaToken] = useState<string | null>(null)
   const form = useForm<z.infer<typeof formSchema>>({
     resolver: zodResolver(formSchema),
     defaultValues: {
@@ -31,7 +40,7 @@ export function LoginForm() {
 
   const onSubmit = async (values: z.infer<typeof formSchema>) => {
     try {
-      const res = await fetch('http://localhost:8080/api/v1/auth/login', {
+      const res = await apiFetch('/api/v1/auth/login', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -39,13 +48,19 @@ export function LoginForm() {
         body: JSON.stringify(values),
       })
 
-      const data = await res.json()
+      const data: LoginResult & { message?: string } = await res.json()
 
       if (!res.ok) {
-        throw new Error(data?.error || 'Invalid credentials')
+        throw new Error(data?.message || 'Invalid credentials')
+      }
+
+      // The password was right; the second factor is asked for next
+      if (data.mfaRequired && data.mfaToken) {
+        setMfaToken(data.mfaToken)
+        return
       }
 
-      login(data.token)
+      login(data)
 
       toast.success('Logged in successfully')
     } catch (error) {
@@ -58,6 +73,10 @@ export function LoginForm() {
     }
   }
 
+  if (mfaToken) {
+    return <MfaForm mfaToken={mfaToken} onCancel={() => setMfaToken(null)} />
+  }
+
   return (
     <Form {...form}>
       <form onSubmit={form.handleSubmit(onSubmit)} className="auth-form">
@@ -95,3 +114,81 @@ export function LoginForm() {
     </Form>
   )
 }
+
+interface MfaFormProps {
+  mfaToken: string
+  onCancel: () => void
+}
+
+// MfaForm finishes a login for an account with two-factor authentication
+function MfaForm({ mfaToken, onCancel }: MfaFormProps) {
+  const { login } = useAuthStore()
+  const form = useForm<z.infer<typeof mfaSchema>>({
+    resolver: zodResolver(mfaSchema),
+    defaultValues: {
+      code: '',
+    },
+  })
+
+  const onSubmit = async (values: z.infer<typeof mfaSchema>) => {
+    try {
+      const res = await apiFetch('/api/v1/auth/login/mfa', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ mfaToken, code: values.code }),
+      })
+
+      const data: LoginResult & { code?: string; message?: string } = await res.json()
+
+      if (!res.ok) {
+        // The challenge has expired or was revoked, so the password is needed again
+        if (data?.code !== 'INVALID_MFA_CODE' && res.status === 401) onCancel()
+        throw new Error(data?.message || 'Invalid code')
+      }
+
+      login(data)
+
+      toast.success('Logged in successfully')
+    } catch (error) {
+      form.reset()
+      toast.error('Login failed', {
+        description:
+          error instanceof Error ? error.message : 'Please check the code and try again',
+      })
+    }
+  }
+
+  return (
+    <Form {...form}>
+      <form onSubmit={form.handleSubmit(onSubmit)} className="auth-form">
+        <div className="auth-title">Two-factor authentication</div>
+        <FormField
+          control={form.control}
+          name="code"
+          render={({ field }) => (
+            <FormItem>
+              <FormLabel>Code from your authenticator app or a recovery code</FormLabel>
+              <FormControl>
+                <Input
+                  autoComplete="one-time-code"
+                  autoFocus
+                  placeholder="123456"
+                  {...field}
+                />
+              </FormControl>
+              <FormMessage />
+            </FormItem>
+          )}
+        />
+        <Button type="submit" className="primary-button">
+          Verify
+        </Button>
+        <Button type="button" variant="link" onClick={onCancel}>
+          Back to login
+        </Button>
+      </form>
+    </Form>
+  )
+}
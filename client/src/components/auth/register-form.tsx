@@ -5,7 +5,7 @@ import { Button } from "@/components/ui/button"
 import { Form, FormControl, FormField, FormItem, FormLabel, FormMessage } from "@/components/ui/form"
 import { Input } from "@/components/ui/input"
 import { toast } from "sonner"
-import { useAuthStore } from "@/lib/auth"
+import { apiFetch, useAuthStore } from "@/lib/auth"
 
 const formSchema = z.object({
   name: z.string().min(2),
@@ -27,7 +27,7 @@ export function RegisterForm() {
 
   async function onSubmit(values: z.infer<typeof formSchema>) {
     try {
-      const res = await fetch('http://localhost:8080/api/v1/auth/register', {
+      const res = await apiFetch('/api/v1/auth/register', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -38,7 +38,7 @@ export function RegisterForm() {
       if (!res.ok) throw new Error(data.error || 'Registration failed')
       
       // After successful registration, log the user in
-      const loginRes = await fetch('http://localhost:8080/api/v1/auth/login', {
+      const loginRes = await apiFetch('/api/v1/auth/login', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -51,7 +51,7 @@ export function RegisterForm() {
       const loginData = await loginRes.json()
       if (!loginRes.ok) throw new Error(loginData.error || 'Login failed')
       
-      login(loginData.token)
+      login(loginData)
       const json = {
         title: "Success",
         description: "Your account has been created.",
@@ -0,0 +1,65 @@
+import { useState } from 'react'
+import { Bell } from 'lucide-react'
+import { Button } from '@/components/ui/button'
+import { useNotifications } from '@/lib/notifications'
+import type { InboxNotification } from '@/lib/notifications'
+
+export function Inbox() {
+  const { notifications, unread, markRead, markAllRead } = useNotifications()
+  const [open, setOpen] = useState(false)
+
+  const openNotification = async (notification: InboxNotification) => {
+    await markRead(notification)
+    if (notification.url) window.location.assign(notification.url)
+  }
+
+  return (
+    <div className="inbox">
+      <Button
+        variant="ghost"
+        size="icon"
+        onClick={() => setOpen(!open)}
+        aria-label={unread > 0 ? `Notifications, ${unread} unread` : 'Notifications'}
+        aria-expanded={open}
+      >
+        <Bell className="h-5 w-5" />
+        {unread > 0 && <span className="inbox-badge">{unread > 99 ? '99+' : unread}</span>}
+      </Button>
+
+      {open && (
+        <div className="inbox-panel">
+          <div className="inbox-header">
+            <span className="inbox-title">Notifications</span>
+            {unread > 0 && (
+              <Button variant="link" size="sm" onClick={markAllRead}>
+                Mark all read
+              </Button>
+            )}
+          </div>
+
+          {notifications.length === 0 ? (
+            <div className="inbox-empty">You're all caught up</div>
+          ) : (
+            <ul className="inbox-list">
+              {notifications.map((notification) => (
+                <li key={notification.id}>
+                  <button
+                    type="button"
+                    className={notification.readAt ? 'inbox-item' : 'inbox-item inbox-item-unread'}
+                    onClick={() => openNotification(notification)}
+                  >
+                    <span className="inbox-item-title">{notification.title}</span>
+                    {notification.body && <span className="inbox-item-body">{notification.body}</span>}
+                    <span className="inbox-item-time">
+                      {new Date(notification.createdAt).toLocaleString()}
+                    </span>
+                  </button>
+                </li>
+              ))}
+            </ul>
+          )}
+        </div>
+      )}
+    </div>
+  )
+}
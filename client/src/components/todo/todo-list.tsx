@@ -1,5 +1,5 @@
 import { useEffect, useState } from 'react'
-import { useAuthStore } from '@/lib/auth'
+import { apiFetch, useAuthStore } from '@/lib/auth'
 import { Button } from '@/components/ui/button'
 import { Input } from '@/components/ui/input'
 import { TodoItem } from './todo-item'
@@ -22,16 +22,12 @@ export function TodoList() {
   const [description, setDescription] = useState('')
   const [isLoading, setIsLoading] = useState(false)
   const [filter, setFilter] = useState<FilterType>('all')
-  const { token } = useAuthStore()
+  const { isAuthenticated } = useAuthStore()
 
   const fetchTodos = async () => {
     setIsLoadingTodos(true)
     try {
-      const res = await fetch('http://localhost:8080/api/v1/todos', { 
-        headers: {
-          Authorization: `Bearer ${token}`,
-        },
-      })
+      const res = await apiFetch('/api/v1/todos')
       if (!res.ok) throw new Error('Failed to fetch todos')
       const data = await res.json()
       setTodos(data || []) // Ensure we always set an array
@@ -52,11 +48,10 @@ export function TodoList() {
     e.preventDefault()
     setIsLoading(true)
     try {
-      const res = await fetch('http://localhost:8080/api/v1/todos', {
+      const res = await apiFetch('/api/v1/todos', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
-          Authorization: `Bearer ${token}`,
         },
         body: JSON.stringify({ title, description }),
       })
@@ -83,11 +78,8 @@ export function TodoList() {
 
   const onDelete = async (id: string) => {
     try {
-      const res = await fetch(`http://localhost:8080/api/v1/todos/${id}`, {
+      const res = await apiFetch(`/api/v1/todos/${id}`, {
         method: 'DELETE',
-        headers: {
-          Authorization: `Bearer ${token}`,
-        },
       })
       if (!res.ok) throw new Error('Failed to delete todo')
       setTodos(todos.filter(todo => todo.id !== id))
@@ -103,11 +95,10 @@ export function TodoList() {
 
   const onToggle = async (id: string, completed: boolean) => {
     try {
-      const res = await fetch(`http://localhost:8080/api/v1/todos/${id}`, {
+      const res = await apiFetch(`/api/v1/todos/${id}`, {
         method: 'PATCH',
         headers: {
           'Content-Type': 'application/json',
-          Authorization: `Bearer ${token}`,
         },
         body: JSON.stringify({ completed }),
       })
@@ -127,11 +118,10 @@ export function TodoList() {
 
   const onEdit = async (id: string, title: string, description: string) => {
     try {
-      const res = await fetch(`http://localhost:8080/api/v1/todos/${id}`, {
+      const res = await apiFetch(`/api/v1/todos/${id}`, {
         method: 'PATCH',
         headers: {
           'Content-Type': 'application/json',
-          Authorization: `Bearer ${token}`,
         },
         body: JSON.stringify({ title, description }),
       })
@@ -155,10 +145,10 @@ export function TodoList() {
   }
 
   useEffect(() => {
-    if (token) {
+    if (isAuthenticated) {
       fetchTodos()
     }
-  }, [token])
+  }, [isAuthenticated])
 
   const filteredTodos = (todos || []).filter(todo => {
     switch (filter) {
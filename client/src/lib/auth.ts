@@ -1,21 +1,85 @@
 import { create } from 'zustand';
 
+export const API_URL = 'http://localhost:8080';
+
+// In cookie mode the API keeps the JWT in an HttpOnly cookie, so it never
+// touches localStorage. Mutating requests then need the CSRF token instead.
+// Enable it together with AUTH_COOKIES=true on the server.
+const cookieMode = import.meta.env.VITE_AUTH_MODE === 'cookie';
+
+export interface LoginResult {
+  token?: string;
+  csrfToken?: string;
+  // Set instead of a token when the account has two-factor authentication;
+  // mfaToken is exchanged, with a code, at /api/v1/auth/login/mfa
+  mfaRequired?: boolean;
+  mfaToken?: string;
+}
+
 interface AuthState {
   token: string | null;
+  csrfToken: string | null;
   isAuthenticated: boolean;
-  login: (token: string) => void;
-  logout: () => void;
+  login: (result: LoginResult) => void;
+  logout: () => Promise<void>;
 }
 
-export const useAuthStore = create<AuthState>((set: (arg0: { token: string | null; isAuthenticated: boolean; }) => void) => ({
-  token: localStorage.getItem('token'),
-  isAuthenticated: !!localStorage.getItem('token'),
-  login: (token: string) => {
-    localStorage.setItem('token', token);
-    set({ token, isAuthenticated: true });
+export const useAuthStore = create<AuthState>((set, get) => ({
+  token: cookieMode ? null : localStorage.getItem('token'),
+  csrfToken: cookieMode ? sessionStorage.getItem('csrfToken') : null,
+  isAuthenticated: cookieMode
+    ? localStorage.getItem('authenticated') === 'true'
+    : !!localStorage.getItem('token'),
+  login: (result: LoginResult) => {
+    if (cookieMode) {
+      localStorage.setItem('authenticated', 'true');
+      if (result.csrfToken) sessionStorage.setItem('csrfToken', result.csrfToken);
+      set({ csrfToken: result.csrfToken ?? null, isAuthenticated: true });
+      return;
+    }
+    if (!result.token) return;
+    localStorage.setItem('token', result.token);
+    set({ token: result.token, isAuthenticated: true });
   },
-  logout: () => {
+  logout: async () => {
+    if (get().isAuthenticated) {
+      // Ends the session on the server; the cookie can't be cleared from here
+      await apiFetch('/api/v1/auth/logout', { method: 'POST' }).catch(() => undefined);
+    }
     localStorage.removeItem('token');
-    set({ token: null, isAuthenticated: false });
+    localStorage.removeItem('authenticated');
+    sessionStorage.removeItem('csrfToken');
+    set({ token: null, csrfToken: null, isAuthenticated: false });
   },
-}));
\ No newline at end of file
+}));
+
+async function csrfToken(): Promise<string | null> {
+  const current = useAuthStore.getState().csrfToken;
+  if (current) return current;
+
+  // A new tab has the cookie but not the token
+  const res = await fetch(`${API_URL}/api/v1/auth/csrf`, { credentials: 'include' });
+  if (!res.ok) return null;
+  const data = await res.json();
+  sessionStorage.setItem('csrfToken', data.csrfToken);
+  useAuthStore.setState({ csrfToken: data.csrfToken });
+  return data.csrfToken;
+}
+
+// apiFetch calls the API with whatever credentials the current auth mode uses.
+export async function apiFetch(path: string, init: RequestInit = {}): Promise<Response> {
+  const headers = new Headers(init.headers);
+  const method = (init.method ?? 'GET').toUpperCase();
+
+  if (cookieMode) {
+    if (!['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+      const token = await csrfToken();
+      if (token) headers.set('X-CSRF-Token', token);
+    }
+    return fetch(`${API_URL}${path}`, { ...init, headers, credentials: 'include' });
+  }
+
+  const { token } = useAuthStore.getState();
+  if (token) headers.set('Authorization', `Bearer ${token}`);
+  return fetch(`${API_URL}${path}`, { ...init, headers });
+}
@@ -0,0 +1,160 @@
+import { useCallback, useEffect, useState } from 'react';
+import { toast } from 'sonner';
+import { apiFetch, useAuthStore } from '@/lib/auth';
+
+export interface InboxNotification {
+  id: string;
+  type: string;
+  title: string;
+  body: string;
+  todoId?: string;
+  url?: string;
+  readAt?: string;
+  createdAt: string;
+}
+
+interface NotificationPage {
+  notifications: InboxNotification[];
+  total: number;
+  unread: number;
+  page: number;
+  pageSize: number;
+}
+
+const INBOX_SIZE = 20;
+const RETRY_MS = 5000;
+
+// readEvents calls onEvent for every server-sent event in the response body
+// until the server closes the stream.
+async function readEvents(res: Response, onEvent: (event: string, data: string) => void) {
+  if (!res.body) return;
+  const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+
+  let buffer = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) return;
+    buffer += value.replace(/\r\n?/g, '\n');
+
+    let end: number;
+    while ((end = buffer.indexOf('\n\n')) !== -1) {
+      const block = buffer.slice(0, end);
+      buffer = buffer.slice(end + 2);
+
+      let event = 'message';
+      const data: string[] = [];
+      for (const line of block.split('\n')) {
+        if (line.startsWith(':')) continue; // keep-alive comment
+        const colon = line.indexOf(':');
+        const field = colon === -1 ? line : line.slice(0, colon);
+        const value = colon === -1 ? '' : line.slice(colon + 1).replace(/^ /, '');
+        if (field === 'event') event = value;
+        if (field === 'data') data.push(value);
+      }
+      if (data.length > 0) onEvent(event, data.join('\n'));
+    }
+  }
+}
+
+function wait(ms: number, signal: AbortSignal) {
+  return new Promise<void>((resolve) => {
+    const timer = setTimeout(resolve, ms);
+    signal.addEventListener('abort', () => {
+      clearTimeout(timer);
+      resolve();
+    });
+  });
+}
+
+interface StreamHandlers {
+  // onOpen runs every time the stream (re)connects; notifications sent while
+  // it was closed are only in the inbox
+  onOpen: () => void;
+  onNotification: (notification: InboxNotification) => void;
+}
+
+// streamNotifications keeps the notification stream open until signal is
+// aborted. It reads the stream with fetch rather than EventSource, which
+// cannot send the Authorization header, so it works in both auth modes.
+async function streamNotifications(handlers: StreamHandlers, signal: AbortSignal) {
+  while (!signal.aborted) {
+    try {
+      const res = await apiFetch('/api/v1/notifications/stream', {
+        headers: { Accept: 'text/event-stream' },
+        signal,
+      });
+      if (res.status === 401) {
+        await useAuthStore.getState().logout();
+        return;
+      }
+      if (res.ok) {
+        handlers.onOpen();
+        await readEvents(res, (event, data) => {
+          if (event === 'notification') handlers.onNotification(JSON.parse(data));
+        });
+      }
+    } catch {
+      // Dropped connections are retried below
+    }
+    await wait(RETRY_MS, signal);
+  }
+}
+
+// useNotifications loads the inbox and keeps it up to date while the user is
+// signed in.
+export function useNotifications() {
+  const { isAuthenticated } = useAuthStore();
+  const [notifications, setNotifications] = useState<InboxNotification[]>([]);
+  const [unread, setUnread] = useState(0);
+
+  const load = useCallback(async () => {
+    const res = await apiFetch(`/api/v1/notifications?pageSize=${INBOX_SIZE}`);
+    if (!res.ok) return;
+    const page: NotificationPage = await res.json();
+    setNotifications(page.notifications);
+    setUnread(page.unread);
+  }, []);
+
+  useEffect(() => {
+    setNotifications([]);
+    setUnread(0);
+    if (!isAuthenticated) return;
+
+    const controller = new AbortController();
+    streamNotifications(
+      {
+        onOpen: () => void load(),
+        onNotification: (notification) => {
+          setNotifications((current) =>
+            [notification, ...current.filter((n) => n.id !== notification.id)].slice(0, INBOX_SIZE),
+          );
+          setUnread((count) => count + 1);
+          toast(notification.title, { description: notification.body });
+        },
+      },
+      controller.signal,
+    );
+    return () => controller.abort();
+  }, [isAuthenticated, load]);
+
+  const markRead = useCallback(async (notification: InboxNotification) => {
+    if (notification.readAt) return;
+    const res = await apiFetch(`/api/v1/notifications/${notification.id}/read`, { method: 'POST' });
+    if (!res.ok) return;
+    const readAt = new Date().toISOString();
+    setNotifications((current) =>
+      current.map((n) => (n.id === notification.id ? { ...n, readAt } : n)),
+    );
+    setUnread((count) => Math.max(0, count - 1));
+  }, []);
+
+  const markAllRead = useCallback(async () => {
+    const res = await apiFetch('/api/v1/notifications/read-all', { method: 'POST' });
+    if (!res.ok) return;
+    const readAt = new Date().toISOString();
+    setNotifications((current) => current.map((n) => ({ ...n, readAt: n.readAt ?? readAt })));
+    setUnread(0);
+  }, []);
+
+  return { notifications, unread, markRead, markAllRead };
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePasswordRequest represents the change password payload
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required" example:"secret123"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8,max=72" example:"new-secret123"`
+}
+
+// ChangeEmailRequest represents the change email payload
+type ChangeEmailRequest struct {
+	Email           string `json:"email" validate:"required,email,max=255" example:"new@example.com"`
+	CurrentPassword string `json:"currentPassword" validate:"required" example:"secret123"`
+}
+
+// @Summary Get the current user
+// @Description Returns the account of the authenticated user.
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} database.User
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/me [get]
+func (app *application) handleGetMe(c echo.Context) error {
+	return c.JSON(http.StatusOK, app.GetUserFromContext(c))
+}
+
+// @Summary Update the current user
+// @Description Updates the name, time zone, or locale of the authenticated user.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user body database.UserPatch true "Fields to update"
+// @Success 200 {object} database.User
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/me [patch]
+func (app *application) handleUpdateMe(c echo.Context) error {
+	var input database.UserPatch
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	updated, err := app.models.Users.Update(user.Id, &input)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update account",
+		})
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// @Summary Change password
+// @Description Changes the password of the authenticated user. All other sessions are signed out, API tokens are deleted and a fresh token is returned.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} main.LoginResponse
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {object} main.ErrorResponse
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/me/password [post]
+func (app *application) handleChangePassword(c echo.Context) error {
+	var input ChangePasswordRequest
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrUnauthorized,
+			Message: "Current password is incorrect",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to change password",
+		})
+	}
+
+	user.TokenVersion, err = app.models.Users.UpdatePassword(user.Id, string(hashedPassword))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to change password",
+		})
+	}
+
+	// The old password may be known to someone else, so sign out other devices
+	// and drop the access tokens that could have been created with it
+	if err := app.revokeAllSessions(user.Id); err != nil {
+		log.Printf("change password: %v", err)
+	}
+	if err := app.models.APITokens.DeleteAllForUser(user.Id); err != nil {
+		log.Printf("change password: %v", err)
+	}
+
+	token, err := app.generateToken(c, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Error generating token",
+		})
+	}
+
+	return app.loginResponse(c, token)
+}
+
+// @Summary Change email
+// @Description Asks to change the email address of the authenticated user. The new address is kept as pendingEmail and replaces the current one once the link sent to it is opened; the current address is told about the request.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.ChangeEmailRequest true "New email and current password"
+// @Success 202 {object} database.User
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {object} main.ErrorResponse
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Failure 409 {object} main.ErrorResponse
+// @Router /api/v1/me/email [post]
+func (app *application) handleChangeEmail(c echo.Context) error {
+	var input ChangeEmailRequest
+
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrUnauthorized,
+			Message: "Current password is incorrect",
+		})
+	}
+
+	if err := app.models.Users.SetPendingEmail(user.Id, input.Email); err != nil {
+		if errors.Is(err, database.ErrDuplicateEmail) {
+			return c.JSON(http.StatusConflict, ErrorResponse{
+				Code:    ErrConflict,
+				Message: "Email is already in use",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to change email",
+		})
+	}
+
+	updated, err := app.models.Users.Get(user.Id)
+	if err != nil || updated == nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to change email",
+		})
+	}
+
+	if err := app.sendEmailChangeLinks(updated); err != nil {
+		log.Printf("change email: sending confirmation email: %v", err)
+	}
+
+	return c.JSON(http.StatusAccepted, updated)
+}
+
+// @Summary Delete the current user
+// @Description Permanently deletes the authenticated user and all of their todos.
+// @Tags account
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 409 {object} main.ErrorResponse "The user is the only owner of an organisation"
+// @Router /api/v1/me [delete]
+func (app *application) handleDeleteMe(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+
+	if err := app.models.Users.Delete(user.Id); err != nil {
+		if errors.Is(err, database.ErrSoleOwner) {
+			return c.JSON(http.StatusConflict, ErrorResponse{
+				Code:    ErrConflict,
+				Message: "You are the only owner of an organisation; transfer ownership or delete it first",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete account",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
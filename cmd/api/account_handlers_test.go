@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// getStatus sends an authenticated GET to path and returns the status code.
+func getStatus(t *testing.T, handler http.Handler, path, token string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestChangePasswordRevokesTokensAtOnce(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	handler := app.routes()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+	hash, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.models.Users.UpdatePassword(user.Id, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = app.models.Users.Get(user.Id)
+
+	// Both are issued within the same second as the change below
+	oldToken := testToken(t, app, user.Id)
+	challenge := app.generateMFAChallenge(user)
+
+	var res LoginResponse
+	postJSON(t, handler, "/api/v1/me/password", oldToken, ChangePasswordRequest{
+		CurrentPassword: "old-password",
+		NewPassword:     "new-password",
+	}, http.StatusOK, &res)
+
+	if status := getStatus(t, handler, "/api/v1/me", oldToken); status != http.StatusUnauthorized {
+		t.Errorf("old token: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := getStatus(t, handler, "/api/v1/me", res.Token); status != http.StatusOK {
+		t.Errorf("new token: status = %d, want %d", status, http.StatusOK)
+	}
+
+	var failure ErrorResponse
+	postJSON(t, handler, "/api/v1/auth/login/mfa", "", MFALoginRequest{
+		MFAToken: challenge,
+		Code:     "000000",
+	}, http.StatusUnauthorized, &failure)
+	if failure.Code != ErrTokenRevoked {
+		t.Errorf("login challenge: code = %s, want %s", failure.Code, ErrTokenRevoked)
+	}
+}
+
+func TestMFAChallengeCarriesTokenVersion(t *testing.T) {
+	app := newTestApp(t)
+
+	challenge := app.generateMFAChallenge(&database.User{Id: "user-1", TokenVersion: 3})
+	payload, err := utils.VerifyToken([]byte(app.tokenSecret), challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mfaChallengePurpose + ":user-1:3"; payload != want {
+		t.Errorf("payload = %q, want %q", payload, want)
+	}
+}
+
+// recordingMailer keeps the messages sent through it.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenLink = regexp.MustCompile(`\?token=(\S+)`)
+
+func TestChangeEmailWaitsForConfirmation(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	mails := &recordingMailer{}
+	app.mailer = mails
+	handler := app.routes()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.models.Users.UpdatePassword(user.Id, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+	token := testToken(t, app, user.Id)
+	createTestUser(t, app, "taken@example.com", true)
+
+	postJSON(t, handler, "/api/v1/me/email", token, ChangeEmailRequest{
+		Email:           "taken@example.com",
+		CurrentPassword: "password",
+	}, http.StatusConflict, nil)
+
+	var pending database.User
+	postJSON(t, handler, "/api/v1/me/email", token, ChangeEmailRequest{
+		Email:           "lovelace@example.com",
+		CurrentPassword: "password",
+	}, http.StatusAccepted, &pending)
+	if pending.Email != "ada@example.com" || pending.PendingEmail == nil || *pending.PendingEmail != "lovelace@example.com" {
+		t.Fatalf("email = %s, pending = %v; want the old address with the new one pending", pending.Email, pending.PendingEmail)
+	}
+
+	if len(mails.sent) != 2 || mails.sent[0].To != "lovelace@example.com" || mails.sent[1].To != "ada@example.com" {
+		t.Fatalf("sent = %+v, want a link to the new address and a notice to the old one", mails.sent)
+	}
+	match := tokenLink.FindStringSubmatch(mails.sent[0].Body)
+	if match == nil {
+		t.Fatalf("no link in %q", mails.sent[0].Body)
+	}
+	link, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postJSON(t, handler, "/api/v1/auth/verify", "", VerifyEmailRequest{Token: link}, http.StatusNoContent, nil)
+
+	changed, err := app.models.Users.Get(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Email != "lovelace@example.com" || changed.PendingEmail != nil || changed.EmailVerifiedAt == nil {
+		t.Errorf("after confirming: email = %s, pending = %v, verified = %v", changed.Email, changed.PendingEmail, changed.EmailVerifiedAt)
+	}
+
+	// The link only works once
+	postJSON(t, handler, "/api/v1/auth/verify", "", VerifyEmailRequest{Token: link}, http.StatusBadRequest, nil)
+}
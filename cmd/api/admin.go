@@ -0,0 +1,300 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Actions written to the admin audit log.
+const (
+	auditUserList          = "user.list"
+	auditUserView          = "user.view"
+	auditUserDisable       = "user.disable"
+	auditUserEnable        = "user.enable"
+	auditUserPasswordReset = "user.password_reset"
+	auditLogView           = "audit.view"
+)
+
+// AdminUserQuery filters the admin user list
+type AdminUserQuery struct {
+	Search   string `query:"q" validate:"max=255" example:"jane"`
+	Page     int    `query:"page" validate:"omitempty,min=1" example:"1"`
+	PageSize int    `query:"pageSize" validate:"omitempty,min=1,max=100" example:"50"`
+}
+
+// AdminUserList is a page of users
+type AdminUserList struct {
+	Users    []database.AdminUser `json:"users"`
+	Total    int                  `json:"total" example:"120"`
+	Page     int                  `json:"page" example:"1"`
+	PageSize int                  `json:"pageSize" example:"50"`
+}
+
+// auditAdminAction records an admin action. Failing to write the entry is
+// logged but does not undo the action.
+func (app *application) auditAdminAction(c echo.Context, action string, targetUserId *string) {
+	actor := app.GetUserFromContext(c)
+	entry := database.AuditEntry{
+		ActorId:      &actor.Id,
+		Action:       action,
+		TargetUserId: targetUserId,
+		IPAddress:    c.RealIP(),
+	}
+	if err := app.models.Admin.InsertAuditEntry(&entry); err != nil {
+		log.Printf("admin audit %s: %v", action, err)
+	}
+}
+
+// @Summary List users
+// @Description Lists users with their todo counts, optionally filtered by email or name. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param q query string false "Search email and name"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Users per page, at most 100"
+// @Success 200 {object} main.AdminUserList
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Router /api/v1/admin/users [get]
+func (app *application) handleAdminListUsers(c echo.Context) error {
+	var input AdminUserQuery
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.PageSize == 0 {
+		input.PageSize = 50
+	}
+
+	users, total, err := app.models.Admin.SearchUsers(input.Search, input.PageSize, (input.Page-1)*input.PageSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch users",
+		})
+	}
+
+	app.auditAdminAction(c, auditUserList, nil)
+
+	return c.JSON(http.StatusOK, AdminUserList{
+		Users:    users,
+		Total:    total,
+		Page:     input.Page,
+		PageSize: input.PageSize,
+	})
+}
+
+// @Summary Get a user
+// @Description Returns a user with their todo counts. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} database.AdminUser
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/admin/users/{id} [get]
+func (app *application) handleAdminGetUser(c echo.Context) error {
+	user, err := app.models.Admin.GetUser(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch user",
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "User not found",
+		})
+	}
+
+	app.auditAdminAction(c, auditUserView, &user.Id)
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// @Summary Disable a user
+// @Description Disables an account, signs it out everywhere and deletes its API tokens. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 409 {object} main.ErrorResponse "Admins cannot disable themselves"
+// @Router /api/v1/admin/users/{id}/disable [post]
+func (app *application) handleAdminDisableUser(c echo.Context) error {
+	id := c.Param("id")
+	if id == app.GetUserFromContext(c).Id {
+		return c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    ErrConflict,
+			Message: "You cannot disable your own account",
+		})
+	}
+
+	if err := app.models.Users.SetDisabled(id, true); err != nil {
+		return app.adminUserUpdateError(c, err)
+	}
+	if err := app.revokeAllSessions(id); err != nil {
+		log.Printf("disable user: %v", err)
+	}
+	// Re-enabling the account must not bring its old API tokens back
+	if err := app.models.APITokens.DeleteAllForUser(id); err != nil {
+		log.Printf("disable user: %v", err)
+	}
+
+	app.auditAdminAction(c, auditUserDisable, &id)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Enable a user
+// @Description Re-enables a disabled account. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/admin/users/{id}/enable [post]
+func (app *application) handleAdminEnableUser(c echo.Context) error {
+	id := c.Param("id")
+
+	if err := app.models.Users.SetDisabled(id, false); err != nil {
+		return app.adminUserUpdateError(c, err)
+	}
+
+	app.auditAdminAction(c, auditUserEnable, &id)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Force a password reset
+// @Description Invalidates the user's password, signs them out everywhere, deletes their API tokens and emails them a reset link. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 202 {string} string "Accepted"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/admin/users/{id}/password-reset [post]
+func (app *application) handleAdminForcePasswordReset(c echo.Context) error {
+	user, err := app.models.Users.Get(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+	if user == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "User not found",
+		})
+	}
+
+	// Replace the password with one nobody knows, so the old one stops
+	// working until the user picks a new one from the email.
+	secret, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+	if _, err := app.models.Users.UpdatePassword(user.Id, string(hashedPassword)); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+	if err := app.revokeAllSessions(user.Id); err != nil {
+		log.Printf("force password reset: %v", err)
+	}
+	if err := app.models.APITokens.DeleteAllForUser(user.Id); err != nil {
+		log.Printf("force password reset: %v", err)
+	}
+
+	app.auditAdminAction(c, auditUserPasswordReset, &user.Id)
+
+	app.background(func() {
+		intro := "An administrator has reset the password for your account. " +
+			"Open the link below to choose a new one:"
+		outro := "If the link expires you can ask for a new one from the login page."
+		if err := app.sendPasswordResetEmail(user, intro, outro); err != nil {
+			log.Printf("force password reset: %v", err)
+		}
+	})
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// @Summary View the audit log
+// @Description Lists the most recent admin actions, optionally only those on one user. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param userId query string false "Only actions on this user"
+// @Success 200 {array} database.AuditEntry
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Router /api/v1/admin/audit-log [get]
+func (app *application) handleAdminGetAuditLog(c echo.Context) error {
+	userId := c.QueryParam("userId")
+	entries, err := app.models.Admin.GetAuditLog(userId, 200)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch audit log",
+		})
+	}
+
+	var target *string
+	if userId != "" {
+		target = &userId
+	}
+	app.auditAdminAction(c, auditLogView, target)
+	return c.JSON(http.StatusOK, entries)
+}
+
+func (app *application) adminUserUpdateError(c echo.Context, err error) error {
+	if err.Error() == "user not found" {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "User not found",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Code:    ErrInternal,
+		Message: "Failed to update user",
+	})
+}
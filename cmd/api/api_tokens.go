@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// apiTokenPrefix marks personal access tokens so they are easy to recognise,
+// both by AuthMiddleware and by secret scanners.
+const apiTokenPrefix = "todo_pat_"
+
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	ScopeAccount    = "account"
+	ScopeAdmin      = "admin"
+)
+
+// CreateAPITokenRequest represents the create API token payload
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=255" example:"Backup script"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=todos:read todos:write account admin" example:"todos:read"`
+	ExpiresInDays *int     `json:"expiresInDays,omitempty" validate:"omitempty,min=1,max=365" example:"90"`
+}
+
+// CreateAPITokenResponse contains the new token. The secret is only shown once.
+type CreateAPITokenResponse struct {
+	database.APIToken
+	Token string `json:"token" example:"todo_pat_q3X9..."`
+}
+
+// RequireScope rejects requests authenticated with an API token that was not
+// granted scope. Requests authenticated with a login JWT have every scope.
+func (app *application) RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scopes, ok := c.Get("tokenScopes").([]string)
+			if !ok {
+				return next(c)
+			}
+
+			for _, s := range scopes {
+				if s == scope {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusForbidden, ErrorResponse{
+				Code:    ErrInsufficientScope,
+				Message: "Token is missing the " + scope + " scope",
+			})
+		}
+	}
+}
+
+// RequireSession rejects requests authenticated with an API token, whatever
+// its scopes. Credentials can only be managed from a login, so a leaked
+// token cannot mint more tokens or add a way to sign in.
+func (app *application) RequireSession() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := c.Get("tokenScopes").([]string); ok {
+				return c.JSON(http.StatusForbidden, ErrorResponse{
+					Code:    ErrInsufficientScope,
+					Message: "API tokens cannot manage credentials; sign in instead",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// @Summary List API tokens
+// @Description Lists the personal access tokens of the authenticated user.
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} database.APIToken
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/me/tokens [get]
+func (app *application) handleGetAPITokens(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	tokens, err := app.models.APITokens.GetAllForUser(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch tokens",
+		})
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// @Summary Create an API token
+// @Description Creates a personal access token for scripts and integrations. Send it as a Bearer token.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.CreateAPITokenRequest true "Token settings"
+// @Success 201 {object} main.CreateAPITokenResponse
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/me/tokens [post]
+func (app *application) handleCreateAPIToken(c echo.Context) error {
+	var input CreateAPITokenRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	secret, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create token",
+		})
+	}
+	plain := apiTokenPrefix + secret
+
+	user := app.GetUserFromContext(c)
+	token := database.APIToken{
+		UserId:      user.Id,
+		Name:        input.Name,
+		TokenHash:   utils.HashToken(plain),
+		TokenPrefix: plain[:len(apiTokenPrefix)+4],
+		Scopes:      input.Scopes,
+	}
+	if input.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *input.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := app.models.APITokens.Insert(&token); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create token",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, CreateAPITokenResponse{APIToken: token, Token: plain})
+}
+
+// @Summary Revoke an API token
+// @Description Deletes a personal access token so it can no longer be used.
+// @Tags account
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/me/tokens/{id} [delete]
+func (app *application) handleDeleteAPIToken(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+
+	if err := app.models.APITokens.Delete(c.Param("id"), user.Id); err != nil {
+		if err.Error() == "token not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Token not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete token",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequireSession(t *testing.T) {
+	app := newTestApp(t)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+
+	for name, scopes := range map[string][]string{
+		"login":       nil,
+		"api token":   {ScopeAccount, ScopeTodosWrite, ScopeAdmin},
+		"empty token": {},
+	} {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		if scopes != nil {
+			c.Set("tokenScopes", scopes)
+		}
+		app.RequireSession()(ok)(c)
+
+		want := http.StatusForbidden
+		if scopes == nil {
+			want = http.StatusNoContent
+		}
+		if got := c.Response().Status; got != want {
+			t.Errorf("%s: status = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestAPITokenCannotManageCredentials(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	handler := app.routes()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+	plain := apiTokenPrefix + "account-scoped-token"
+	token := database.APIToken{
+		UserId:      user.Id,
+		Name:        "Script",
+		TokenHash:   utils.HashToken(plain),
+		TokenPrefix: plain[:len(apiTokenPrefix)+4],
+		Scopes:      []string{ScopeAccount},
+	}
+	if err := app.models.APITokens.Insert(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token still works where its scope allows
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+plain)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /me: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	postJSON(t, handler, "/api/v1/me/tokens", plain, CreateAPITokenRequest{
+		Name:   "Escalated",
+		Scopes: []string{ScopeTodosWrite, ScopeAdmin},
+	}, http.StatusForbidden, nil)
+	postJSON(t, handler, "/api/v1/auth/passkeys/register/begin", plain, nil, http.StatusForbidden, nil)
+	postJSON(t, handler, "/api/v1/me/mfa/totp", plain, nil, http.StatusForbidden, nil)
+
+	tokens, err := app.models.APITokens.GetAllForUser(user.Id)
+	if err != nil || len(tokens) != 1 {
+		t.Errorf("tokens = %v, %v; want only the original", tokens, err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+	"github.com/janst44/go-react-todo/internal/blob"
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// attachmentSweepBatch is how many detached attachments are removed from
+// blob storage per database round trip.
+const attachmentSweepBatch = 100
+
+// @Summary List attachments
+// @Description Lists the files attached to a todo.
+// @Tags attachments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Success 200 {array} database.Attachment
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/attachments [get]
+func (app *application) handleGetAttachments(c echo.Context) error {
+	attachments, err := app.models.Attachments.GetForTodo(todoFromContext(c).Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch attachments",
+		})
+	}
+	return c.JSON(http.StatusOK, attachments)
+}
+
+// @Summary Upload an attachment
+// @Description Attaches a file to a todo the authenticated user can change. The file type is detected from its contents and must be one of the allowed types.
+// @Tags attachments
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param file formData file true "File"
+// @Success 201 {object} database.Attachment
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 413 {object} main.ErrorResponse
+// @Failure 415 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/attachments [post]
+func (app *application) handleUploadAttachment(c echo.Context) error {
+	todo := todoFromContext(c)
+	user := app.GetUserFromContext(c)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Send the file in the file form field",
+		})
+	}
+	if fh.Size > app.attachmentMaxBytes {
+		return c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+			Code:    ErrFileTooLarge,
+			Message: fmt.Sprintf("Files can be at most %d MB", app.attachmentMaxBytes>>20),
+		})
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Could not read the file",
+		})
+	}
+	defer f.Close()
+
+	// Trust the contents, not the extension or the Content-Type the client sent
+	detected, err := mimetype.DetectReader(f)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Could not read the file",
+		})
+	}
+	contentType, ok := app.allowedAttachmentType(detected)
+	if !ok {
+		return c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{
+			Code:    ErrUnsupportedFile,
+			Message: fmt.Sprintf("Files of type %s cannot be attached", detected.String()),
+		})
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to upload attachment",
+		})
+	}
+
+	attachment := database.Attachment{
+		TodoId:      &todo.Id,
+		UploaderId:  &user.Id,
+		Filename:    attachmentFilename(fh.Filename),
+		ContentType: contentType,
+		Size:        fh.Size,
+		StorageKey:  "attachments/" + uuid.New().String(),
+	}
+
+	hash := sha256.New()
+	ctx := c.Request().Context()
+	if err := app.blobs.Put(ctx, attachment.StorageKey, io.TeeReader(f, hash), fh.Size, contentType); err != nil {
+		log.Printf("attachment upload: %v", err)
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to upload attachment",
+		})
+	}
+	attachment.SHA256 = hash.Sum(nil)
+
+	if err := app.models.Attachments.Insert(&attachment); err != nil {
+		if err := app.blobs.Delete(context.Background(), attachment.StorageKey); err != nil {
+			log.Printf("attachment cleanup: %v", err)
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to upload attachment",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, attachment)
+}
+
+// @Summary Download an attachment
+// @Description Returns the contents of a file attached to a todo.
+// @Tags attachments
+// @Security BearerAuth
+// @Produce octet-stream
+// @Param id path string true "Todo ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/attachments/{attachmentId} [get]
+func (app *application) handleDownloadAttachment(c echo.Context) error {
+	attachment, err := app.models.Attachments.Get(c.Param("attachmentId"), todoFromContext(c).Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch attachment",
+		})
+	}
+	if attachment == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Attachment not found",
+		})
+	}
+
+	body, err := app.blobs.Get(c.Request().Context(), attachment.StorageKey)
+	if err != nil {
+		if err == blob.ErrNotFound {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Attachment not found",
+			})
+		}
+		log.Printf("attachment download: %v", err)
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch attachment",
+		})
+	}
+	defer body.Close()
+
+	header := c.Response().Header()
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	header.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, no-cache")
+	header.Set("ETag", `"`+attachment.Checksum+`"`)
+	return c.Stream(http.StatusOK, attachment.ContentType, body)
+}
+
+// @Summary Delete an attachment
+// @Description Removes a file from a todo the authenticated user can change.
+// @Tags attachments
+// @Security BearerAuth
+// @Param id path string true "Todo ID"
+// @Param attachmentId path string true "Attachment ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/attachments/{attachmentId} [delete]
+func (app *application) handleDeleteAttachment(c echo.Context) error {
+	todo := todoFromContext(c)
+
+	if err := app.models.Attachments.Detach(c.Param("attachmentId"), todo.Id); err != nil {
+		if err.Error() == "attachment not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Attachment not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete attachment",
+		})
+	}
+
+	app.background(app.sweepAttachments)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// allowedAttachmentType returns the detected type, or the allowed type it
+// is a kind of, if files of that type may be attached.
+func (app *application) allowedAttachmentType(detected *mimetype.MIME) (string, bool) {
+	for m := detected; m != nil; m = m.Parent() {
+		for _, allowed := range app.attachmentTypes {
+			if m.Is(allowed) {
+				return m.String(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// attachmentFilename keeps the name of an uploaded file without any path
+// the browser sent along.
+func attachmentFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[len(name)-255:], "")
+	}
+	return name
+}
+
+// sweepAttachments deletes the files of attachments that were removed or
+// whose todo was deleted, then their rows.
+func (app *application) sweepAttachments() {
+	for {
+		detached, err := app.models.Attachments.GetDetached(attachmentSweepBatch)
+		if err != nil {
+			log.Printf("attachment sweep: %v", err)
+			return
+		}
+
+		for _, a := range detached {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			err := app.blobs.Delete(ctx, a.StorageKey)
+			cancel()
+			if err != nil {
+				// Try again on the next sweep
+				log.Printf("attachment sweep: %v", err)
+				return
+			}
+			if err := app.models.Attachments.Delete(a.Id); err != nil {
+				log.Printf("attachment sweep: %v", err)
+				return
+			}
+		}
+
+		if len(detached) < attachmentSweepBatch {
+			return
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
+	"log"
 	"net/http"
-	"time"
+	"strings"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/janst44/go-react-todo/internal/database"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -12,20 +12,26 @@ import (
 
 // LoginRequest represents the login payload
 type LoginRequest struct {
-	Email    string `json:"email" example:"user@example.com"`
-	Password string `json:"password" example:"secret123"`
+	Email    string `json:"email" validate:"required,email" example:"user@example.com"`
+	Password string `json:"password" validate:"required" example:"secret123"`
 }
 
-// LoginResponse represents the JWT response
+// LoginResponse represents the JWT response. When the account has two-factor
+// authentication enabled, Token is empty and MFAToken must be exchanged at
+// /api/v1/auth/login/mfa instead. In cookie mode the JWT is set as an
+// HttpOnly cookie and only the CSRF token is returned.
 type LoginResponse struct {
-	Token string `json:"token" example:"your.jwt.token"`
+	Token       string `json:"token,omitempty" example:"your.jwt.token"`
+	CSRFToken   string `json:"csrfToken,omitempty" example:""`
+	MFARequired bool   `json:"mfaRequired,omitempty" example:"false"`
+	MFAToken    string `json:"mfaToken,omitempty" example:""`
 }
 
 // RegisterRequest represents the registration payload
 type RegisterRequest struct {
-	Email    string `json:"email" example:"user@example.com"`
-	Password string `json:"password" example:"secret123"`
-	Name     string `json:"name" example:"Jane Doe"`
+	Email    string `json:"email" validate:"required,email,max=255" example:"user@example.com"`
+	Password string `json:"password" validate:"required,min=8,max=72" example:"secret123"`
+	Name     string `json:"name" validate:"required,max=255" example:"Jane Doe"`
 }
 
 // @Summary Registers a new user
@@ -35,7 +41,7 @@ type RegisterRequest struct {
 // @Produce json
 // @Param user body main.RegisterRequest true "User registration payload"
 // @Success 201 {string} string "Created"
-// @Failure 400 {string} string "Bad Request"
+// @Failure 400 {object} main.ValidationResponse
 // @Router /api/v1/auth/register [post]
 func (app *application) registerUser(c echo.Context) error {
 	var register RegisterRequest
@@ -44,6 +50,10 @@ func (app *application) registerUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
 
+	if err := c.Validate(&register); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(register.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Something went wrong"})
@@ -59,18 +69,54 @@ func (app *application) registerUser(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Could not create user"})
 	}
 
+	if err := app.sendVerificationEmail(&user); err != nil {
+		log.Printf("register: sending verification email: %v", err)
+	}
+
 	return c.JSON(http.StatusCreated, user)
 }
 
+// dummyPasswordHash is compared against when a login names an unknown email.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// loginFailed records a failed password login against the client IP and the
+// account, and locks them out once they have failed too often.
+func (app *application) loginFailed(c echo.Context, email string, userId *string, reason string) error {
+	app.auditLoginFailure(c, email, userId, reason)
+
+	wait := max(app.loginIPFailures.Fail(c.RealIP()), app.loginAccountFailures.Fail(email))
+	if wait > 0 {
+		return app.lockedOutResponse(c, wait)
+	}
+	return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid email or password"})
+}
+
+func (app *application) auditLoginFailure(c echo.Context, email string, userId *string, reason string) {
+	failure := database.LoginFailure{
+		Email:     email,
+		UserId:    userId,
+		Reason:    reason,
+		IPAddress: c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+	app.background(func() {
+		if err := app.models.LoginFailures.Insert(&failure); err != nil {
+			log.Printf("login failure audit: %v", err)
+		}
+	})
+}
+
 // @Summary Logs in a user
-// @Description Authenticates a user and returns a JWT token for future requests.
+// @Description Authenticates a user and returns a JWT token for future requests. Accounts with two-factor authentication get an MFA challenge token instead.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body main.LoginRequest true "User login payload"
 // @Success 200 {string} main.LoginResponse
-// @Failure 400 {string} string "Bad Request"
+// @Failure 400 {object} main.ValidationResponse
 // @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Email not verified"
+// @Failure 429 {object} main.ErrorResponse "Too many failed attempts, see Retry-After"
 // @Router /api/v1/auth/login [post]
 func (app *application) login(c echo.Context) error {
 	var auth LoginRequest
@@ -78,27 +124,58 @@ func (app *application) login(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
 
+	if err := c.Validate(&auth); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	ip := c.RealIP()
+	email := strings.ToLower(auth.Email)
+	if wait := max(app.loginIPFailures.Locked(ip), app.loginAccountFailures.Locked(email)); wait > 0 {
+		app.auditLoginFailure(c, email, nil, database.LoginFailureLockedOut)
+		return app.lockedOutResponse(c, wait)
+	}
+
 	existingUser, err := app.models.Users.GetByEmail(auth.Email)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Something went wrong"})
 	}
 	if existingUser == nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid email or password"})
+		// Spend as long as a real password check so response times do not
+		// reveal which emails have accounts.
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(auth.Password))
+		return app.loginFailed(c, email, nil, database.LoginFailureUnknownEmail)
 	}
 
 	if error := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(auth.Password)); error != nil {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid email or password"})
+		return app.loginFailed(c, email, &existingUser.Id, database.LoginFailureWrongPassword)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": existingUser.Id,
-		"exp":    time.Now().Add(72 * time.Hour).Unix(),
-	})
+	// Only the account is reset, or an attacker could clear their IP's
+	// failures by logging in to an account of their own.
+	app.loginAccountFailures.Reset(email)
+
+	if existingUser.DisabledAt != nil {
+		return app.accountDisabledResponse(c)
+	}
+
+	if app.requireEmailVerification && existingUser.EmailVerifiedAt == nil {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrEmailNotVerified,
+			Message: "Please verify your email address before logging in",
+		})
+	}
+
+	if existingUser.TOTPEnabledAt != nil {
+		return c.JSON(http.StatusOK, LoginResponse{
+			MFARequired: true,
+			MFAToken:    app.generateMFAChallenge(existingUser),
+		})
+	}
 
-	tokenString, error := token.SignedString([]byte(app.jwtSecret))
+	tokenString, error := app.generateToken(c, existingUser)
 	if error != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error generating token"})
 	}
 
-	return c.JSON(http.StatusOK, LoginResponse{Token: tokenString})
+	return app.loginResponse(c, tokenString)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+const tokenTTL = 72 * time.Hour
+
+// Claims are the claims carried by the JWTs this API issues. The user id is
+// the subject and the token id (jti) identifies a single login. Version is
+// the user's token version when the token was issued; the token stops working
+// once the version moves on.
+type Claims struct {
+	jwt.RegisteredClaims
+	Version int `json:"ver"`
+}
+
+// generateToken starts a new session for user and issues the JWT for it.
+// The session id is the token's jti, so the session can be revoked before
+// the token expires.
+func (app *application) generateToken(c echo.Context, user *database.User) (string, error) {
+	now := time.Now()
+
+	userAgent := c.Request().UserAgent()
+	session := database.Session{
+		Id:        uuid.NewString(),
+		UserId:    user.Id,
+		Device:    describeDevice(userAgent),
+		UserAgent: userAgent,
+		IPAddress: c.RealIP(),
+		ExpiresAt: now.Add(tokenTTL),
+	}
+	if err := app.models.Sessions.Insert(&session); err != nil {
+		return "", err
+	}
+	app.sessionCache.Set(session.Id, true)
+
+	return app.jwtKeys.Sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.Id,
+			Issuer:    app.jwtIssuer,
+			Audience:  jwt.ClaimStrings{app.jwtAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+			ID:        session.Id,
+		},
+		Version: user.TokenVersion,
+	})
+}
+
+// parseToken verifies the signature of a JWT and every standard claim: the
+// issuer and audience must match ours, and exp, nbf and iat must all be
+// present and valid within the allowed clock skew.
+func (app *application) parseToken(tokenString string) (*Claims, error) {
+	var claims Claims
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, app.jwtKeys.Keyfunc,
+		jwt.WithIssuer(app.jwtIssuer),
+		jwt.WithAudience(app.jwtAudience),
+		jwt.WithLeeway(app.jwtLeeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" || claims.ID == "" || claims.IssuedAt == nil || claims.NotBefore == nil {
+		return nil, jwt.ErrTokenRequiredClaimMissing
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/notify"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// CommentRequest represents the create and edit comment payload
+type CommentRequest struct {
+	Body string `json:"body" validate:"required,max=5000" example:"I'll pick these up on the way home @sam"`
+}
+
+// CommentQuery pages through the comments on a todo
+type CommentQuery struct {
+	Page     int `query:"page" validate:"omitempty,min=1" example:"1"`
+	PageSize int `query:"pageSize" validate:"omitempty,min=1,max=100" example:"50"`
+}
+
+// CommentList is a page of comments
+type CommentList struct {
+	Comments []database.Comment `json:"comments"`
+	Total    int                `json:"total" example:"12"`
+	Page     int                `json:"page" example:"1"`
+	PageSize int                `json:"pageSize" example:"50"`
+}
+
+// @Summary List comments
+// @Description Lists the comments on a todo, oldest first.
+// @Tags comments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Comments per page, at most 100"
+// @Success 200 {object} main.CommentList
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/comments [get]
+func (app *application) handleGetComments(c echo.Context) error {
+	var input CommentQuery
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.PageSize == 0 {
+		input.PageSize = 50
+	}
+
+	comments, total, err := app.models.Comments.GetForTodo(todoFromContext(c).Id, input.PageSize, (input.Page-1)*input.PageSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch comments",
+		})
+	}
+
+	return c.JSON(http.StatusOK, CommentList{
+		Comments: comments,
+		Total:    total,
+		Page:     input.Page,
+		PageSize: input.PageSize,
+	})
+}
+
+// @Summary Comment on a todo
+// @Description Adds a comment to a todo the authenticated user can read. Users mentioned as @email or @name (the part of their email before the @) who can read the todo are notified, as are the todo's assignee and watchers.
+// @Tags comments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param body body main.CommentRequest true "Comment"
+// @Success 201 {object} database.Comment
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/comments [post]
+func (app *application) handleCreateComment(c echo.Context) error {
+	var input CommentRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	todo := todoFromContext(c)
+	comment := database.Comment{
+		TodoId:     todo.Id,
+		AuthorId:   &user.Id,
+		AuthorName: user.Name,
+		Body:       input.Body,
+	}
+	if err := app.models.Comments.Insert(&comment); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to add comment",
+		})
+	}
+
+	app.notifyComment(user, todo, utils.ParseMentions(comment.Body))
+
+	return c.JSON(http.StatusCreated, comment)
+}
+
+// @Summary Edit a comment
+// @Description Changes the body of the authenticated user's own comment. Comments can only be edited for a while after they are posted.
+// @Tags comments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param commentId path string true "Comment ID"
+// @Param body body main.CommentRequest true "Comment"
+// @Success 200 {object} database.Comment
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Edit window has passed"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/comments/{commentId} [patch]
+func (app *application) handleUpdateComment(c echo.Context) error {
+	var input CommentRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	comment, err := app.models.Comments.Update(c.Param("commentId"), todoFromContext(c).Id, user.Id, input.Body, app.commentEditWindow)
+	if err != nil {
+		switch err.Error() {
+		case "comment not found":
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Comment not found",
+			})
+		case "edit window passed":
+			return c.JSON(http.StatusForbidden, ErrorResponse{
+				Code:    ErrForbidden,
+				Message: "This comment can no longer be edited",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to edit comment",
+		})
+	}
+	return c.JSON(http.StatusOK, comment)
+}
+
+// @Summary Delete a comment
+// @Description Deletes a comment. Authors can delete their own comments and users who can manage the todo's list can delete any.
+// @Tags comments
+// @Security BearerAuth
+// @Param id path string true "Todo ID"
+// @Param commentId path string true "Comment ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/comments/{commentId} [delete]
+func (app *application) handleDeleteComment(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	if err := app.models.Comments.Delete(c.Param("commentId"), todoFromContext(c).Id, user.Id); err != nil {
+		if err.Error() == "comment not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Comment not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete comment",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// notifyComment tells the mentioned users that they were mentioned and the
+// todo's other followers that there is a new comment.
+func (app *application) notifyComment(actor *database.User, todo *database.Todo, handles []string) {
+	t := *todo
+	app.background(func() {
+		mentioned := []database.Watcher{}
+		if len(handles) > 0 {
+			var err error
+			mentioned, err = app.models.Comments.GetMentionable(t.Id, handles)
+			if err != nil {
+				log.Printf("comment mentions: %v", err)
+			}
+			app.sendTodoNotices(actor, &t, mentioned, notify.TypeMention, "mentioned you on", false)
+		}
+
+		recipients, err := app.models.Watchers.GetRecipients(t.Id)
+		if err != nil {
+			log.Printf("comment notification: %v", err)
+			return
+		}
+		others := []database.Watcher{}
+		for _, r := range recipients {
+			notified := false
+			for _, m := range mentioned {
+				notified = notified || m.UserId == r.UserId
+			}
+			if !notified {
+				others = append(others, r)
+			}
+		}
+		app.sendTodoNotices(actor, &t, others, notify.TypeComment, "commented on", false)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// In cookie mode the JWT lives in an HttpOnly cookie the client's scripts
+// cannot read. Because browsers send that cookie automatically, requests
+// that change state must also echo the CSRF cookie in the X-CSRF-Token
+// header, which a cross-site attacker cannot do.
+const (
+	sessionCookie = "todo_session"
+	csrfCookie    = "todo_csrf"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// CSRFResponse carries the token to send in the X-CSRF-Token header.
+type CSRFResponse struct {
+	CSRFToken string `json:"csrfToken" example:"b3JpZ2luYWwgY3NyZiB0b2tlbg"`
+}
+
+// parseSameSite reads the COOKIE_SAMESITE setting. None is only useful when
+// the client and API are on different sites, and needs HTTPS.
+func parseSameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+func (app *application) authCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   app.cookieDomain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: app.cookieSameSite,
+	}
+}
+
+// setCSRFCookie issues a new CSRF token.
+func (app *application) setCSRFCookie(c echo.Context) (string, error) {
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	c.SetCookie(app.authCookie(csrfCookie, token, int(tokenTTL.Seconds()), false))
+	return token, nil
+}
+
+func (app *application) clearAuthCookies(c echo.Context) {
+	c.SetCookie(app.authCookie(sessionCookie, "", -1, true))
+	c.SetCookie(app.authCookie(csrfCookie, "", -1, false))
+}
+
+// loginResponse hands a freshly issued JWT to the client: in the response
+// body normally, or as cookies in cookie mode.
+func (app *application) loginResponse(c echo.Context, token string) error {
+	if !app.cookieAuth {
+		return c.JSON(http.StatusOK, LoginResponse{Token: token})
+	}
+
+	csrfToken, err := app.setCSRFCookie(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Error generating token",
+		})
+	}
+	c.SetCookie(app.authCookie(sessionCookie, token, int(tokenTTL.Seconds()), true))
+
+	return c.JSON(http.StatusOK, LoginResponse{CSRFToken: csrfToken})
+}
+
+// validCSRF reports whether a cookie-authenticated request may go ahead.
+// Safe methods are always allowed.
+func validCSRF(c echo.Context) bool {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := c.Request().Header.Get(csrfHeader)
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+// @Summary Get a CSRF token
+// @Description Returns the CSRF token to send in the X-CSRF-Token header when authenticating with the session cookie, issuing one if needed.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} main.CSRFResponse
+// @Router /api/v1/auth/csrf [get]
+func (app *application) handleGetCSRFToken(c echo.Context) error {
+	if cookie, err := c.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return c.JSON(http.StatusOK, CSRFResponse{CSRFToken: cookie.Value})
+	}
+
+	token, err := app.setCSRFCookie(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create CSRF token",
+		})
+	}
+	return c.JSON(http.StatusOK, CSRFResponse{CSRFToken: token})
+}
+
+// @Summary Log out
+// @Description Ends the current session and clears the session cookie.
+// @Tags auth
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Missing or invalid CSRF token"
+// @Router /api/v1/auth/logout [post]
+func (app *application) handleLogout(c echo.Context) error {
+	if id := currentSessionId(c); id != "" {
+		user := app.GetUserFromContext(c)
+		if err := app.models.Sessions.Revoke(id, user.Id); err != nil {
+			log.Printf("logout: %v", err)
+		}
+		app.sessionCache.Revoke(id)
+	}
+
+	app.clearAuthCookies(c)
+	return c.NoContent(http.StatusNoContent)
+}
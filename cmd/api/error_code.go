@@ -3,9 +3,24 @@ package main
 type ErrorCode string
 
 const (
-	ErrValidationFailed ErrorCode = "VALIDATION_FAILED"
-	ErrUnauthorized     ErrorCode = "UNAUTHORIZED"
-	ErrNotFound         ErrorCode = "NOT_FOUND"
-	ErrConflict         ErrorCode = "CONFLICT"
-	ErrInternal         ErrorCode = "INTERNAL"
+	ErrValidationFailed  ErrorCode = "VALIDATION_FAILED"
+	ErrUnauthorized      ErrorCode = "UNAUTHORIZED"
+	ErrForbidden         ErrorCode = "FORBIDDEN"
+	ErrNotFound          ErrorCode = "NOT_FOUND"
+	ErrConflict          ErrorCode = "CONFLICT"
+	ErrInternal          ErrorCode = "INTERNAL"
+	ErrInvalidToken      ErrorCode = "INVALID_TOKEN"
+	ErrTokenExpired      ErrorCode = "TOKEN_EXPIRED"
+	ErrTokenRevoked      ErrorCode = "TOKEN_REVOKED"
+	ErrCSRFInvalid       ErrorCode = "CSRF_TOKEN_INVALID"
+	ErrEmailNotVerified  ErrorCode = "EMAIL_NOT_VERIFIED"
+	ErrAccountDisabled   ErrorCode = "ACCOUNT_DISABLED"
+	ErrRateLimited       ErrorCode = "RATE_LIMITED"
+	ErrAccountLocked     ErrorCode = "ACCOUNT_LOCKED"
+	ErrInvalidMFACode    ErrorCode = "INVALID_MFA_CODE"
+	ErrPasskeyRejected   ErrorCode = "PASSKEY_REJECTED"
+	ErrIdentityProvider  ErrorCode = "IDENTITY_PROVIDER_ERROR"
+	ErrInsufficientScope ErrorCode = "INSUFFICIENT_SCOPE"
+	ErrFileTooLarge      ErrorCode = "FILE_TOO_LARGE"
+	ErrUnsupportedFile   ErrorCode = "UNSUPPORTED_FILE_TYPE"
 )
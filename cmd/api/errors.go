@@ -1,5 +1,14 @@
 package main
 
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
 // ErrorResponse represents a generic error response.
 //
 // swagger:model
@@ -9,13 +18,73 @@ type ErrorResponse struct {
 	Details string    `json:"details,omitempty" example:"optional details about the error"`
 }
 
+// ValidationResponse represents a request that failed field validation.
+//
+// swagger:model
 type ValidationResponse struct {
-	Code    ErrorCode         `json:"code" example:"VALIDATION_ERROR"`
+	Code    ErrorCode         `json:"code" example:"VALIDATION_FAILED"`
 	Message string            `json:"message" example:"Validation failed"`
 	Errors  []ValidationError `json:"errors"`
 }
 
+// ValidationError describes a single invalid field.
 type ValidationError struct {
 	Field   string `json:"field" example:"email"`
 	Message string `json:"message" example:"must be a valid email address"`
 }
+
+// failedValidationResponse writes the field-level errors from c.Validate,
+// translated into the language requested by the client.
+func (app *application) failedValidationResponse(c echo.Context, err error) error {
+	fieldErrors, ok := app.validator.TranslateErrors(err, c.Request().Header.Get("Accept-Language"))
+	if !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrValidationFailed,
+			Message: "Validation failed",
+			Details: err.Error(),
+		})
+	}
+
+	errors := make([]ValidationError, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		errors = append(errors, ValidationError{Field: fe.Field, Message: fe.Message})
+	}
+
+	return c.JSON(http.StatusBadRequest, ValidationResponse{
+		Code:    ErrValidationFailed,
+		Message: "Validation failed",
+		Errors:  errors,
+	})
+}
+
+func (app *application) rateLimitedResponse(c echo.Context) error {
+	return c.JSON(http.StatusTooManyRequests, ErrorResponse{
+		Code:    ErrRateLimited,
+		Message: "Too many requests, please try again later",
+	})
+}
+
+// lockedOutResponse tells a client that has failed to log in too often how
+// long to wait before trying again.
+func (app *application) lockedOutResponse(c echo.Context, retryAfter time.Duration) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return c.JSON(http.StatusTooManyRequests, ErrorResponse{
+		Code:    ErrAccountLocked,
+		Message: "Too many failed login attempts, please try again later",
+	})
+}
+
+func (app *application) accountDisabledResponse(c echo.Context) error {
+	return c.JSON(http.StatusForbidden, ErrorResponse{
+		Code:    ErrAccountDisabled,
+		Message: "This account has been disabled",
+	})
+}
+
+func (app *application) unauthorizedResponse(c echo.Context, code ErrorCode, message string) error {
+	return c.JSON(http.StatusUnauthorized, ErrorResponse{
+		Code:    code,
+		Message: message,
+	})
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// background runs fn in its own goroutine, logging instead of crashing the
+// server if it panics.
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Print(fmt.Errorf("background task panicked: %v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// HistoryQuery pages through the history of a todo
+type HistoryQuery struct {
+	Page     int `query:"page" validate:"omitempty,min=1" example:"1"`
+	PageSize int `query:"pageSize" validate:"omitempty,min=1,max=100" example:"50"`
+}
+
+// TodoHistory is a page of a todo's history
+type TodoHistory struct {
+	Events   []database.TodoEvent `json:"events"`
+	Total    int                  `json:"total" example:"7"`
+	Page     int                  `json:"page" example:"1"`
+	PageSize int                  `json:"pageSize" example:"50"`
+}
+
+// @Summary Get todo history
+// @Description Lists who created, changed or reverted a todo and when, newest first, with the title, description and completion before and after each change.
+// @Tags todos
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Events per page, at most 100"
+// @Success 200 {object} main.TodoHistory
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/history [get]
+func (app *application) handleGetTodoHistory(c echo.Context) error {
+	var input HistoryQuery
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.PageSize == 0 {
+		input.PageSize = 50
+	}
+
+	events, total, err := app.models.Todos.GetHistory(todoFromContext(c).Id, input.PageSize, (input.Page-1)*input.PageSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch history",
+		})
+	}
+
+	return c.JSON(http.StatusOK, TodoHistory{
+		Events:   events,
+		Total:    total,
+		Page:     input.Page,
+		PageSize: input.PageSize,
+	})
+}
+
+// @Summary Revert a todo
+// @Description Restores the title, description and completion of a todo to how they were after an event in its history. The revert is recorded as a new event and the todo's assignee and watchers are notified.
+// @Tags todos
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param eventId path string true "Event ID"
+// @Success 200 {object} database.Todo
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/history/{eventId}/revert [post]
+func (app *application) handleRevertTodo(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+
+	todo, err := app.models.Todos.Revert(todoFromContext(c).Id, c.Param("eventId"), user.Id)
+	if err != nil {
+		switch err.Error() {
+		case "event not found":
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Event not found",
+			})
+		case "todo not found":
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Todo not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to revert todo",
+		})
+	}
+
+	app.notifyTodoChange(user, todo, "reverted", false)
+
+	return c.JSON(http.StatusOK, todo)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// ShareRequest represents the share list payload
+type ShareRequest struct {
+	Email string `json:"email" validate:"required,email,max=255" example:"sam@example.com"`
+	Role  string `json:"role" validate:"required,oneof=owner editor viewer" example:"editor"`
+}
+
+// UpdateShareRequest represents the change share role payload
+type UpdateShareRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer" example:"viewer"`
+}
+
+// ListSharesResponse lists who a list is shared with and who has been invited
+type ListSharesResponse struct {
+	Shares      []database.ListShare       `json:"shares"`
+	Invitations []database.ShareInvitation `json:"invitations"`
+}
+
+// RequireListManager loads the list in the :id path parameter and rejects
+// users who may not share it. Users who cannot see the list get a 404.
+func (app *application) RequireListManager() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := app.GetUserFromContext(c)
+			list, err := app.models.Lists.Get(c.Param("id"), user.Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Code:    ErrInternal,
+					Message: "Failed to fetch list",
+				})
+			}
+			if list == nil {
+				return c.JSON(http.StatusNotFound, ErrorResponse{
+					Code:    ErrNotFound,
+					Message: "List not found",
+				})
+			}
+
+			ok, err := app.models.Lists.CanManage(list.Id, user.Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Code:    ErrInternal,
+					Message: "Failed to fetch list",
+				})
+			}
+			if !ok {
+				return c.JSON(http.StatusForbidden, ErrorResponse{
+					Code:    ErrForbidden,
+					Message: "You do not have permission to do this",
+				})
+			}
+
+			c.Set("list", list)
+			return next(c)
+		}
+	}
+}
+
+func listFromContext(c echo.Context) *database.List {
+	list, _ := c.Get("list").(*database.List)
+	return list
+}
+
+// @Summary List lists shared with me
+// @Description Lists the lists other users have shared with the authenticated user, with the role each was shared with.
+// @Tags sharing
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} database.SharedList
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/shared [get]
+func (app *application) handleGetSharedLists(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	lists, err := app.models.ListShares.GetSharedWithUser(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch shared lists",
+		})
+	}
+	return c.JSON(http.StatusOK, lists)
+}
+
+// @Summary List shares
+// @Description Lists who a list is shared with and the pending share invitations. Only users who can manage the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "List ID"
+// @Success 200 {object} main.ListSharesResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/shares [get]
+func (app *application) handleGetListShares(c echo.Context) error {
+	list := listFromContext(c)
+
+	shares, err := app.models.ListShares.GetForList(list.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch shares",
+		})
+	}
+	invitations, err := app.models.ListShares.GetPendingInvitations(list.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch shares",
+		})
+	}
+
+	return c.JSON(http.StatusOK, ListSharesResponse{Shares: shares, Invitations: invitations})
+}
+
+// @Summary Share a list
+// @Description Emails an invitation to access the list as a viewer, editor or owner. Viewers can read the list's todos, editors can also add and change them and owners can also share and delete the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "List ID"
+// @Param body body main.ShareRequest true "Share"
+// @Success 201 {object} database.ShareInvitation
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/shares [post]
+func (app *application) handleShareList(c echo.Context) error {
+	var input ShareRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to share list",
+		})
+	}
+
+	list := listFromContext(c)
+	user := app.GetUserFromContext(c)
+	invitation := database.ShareInvitation{
+		ListId:    list.Id,
+		Email:     strings.ToLower(input.Email),
+		Role:      input.Role,
+		TokenHash: utils.HashToken(token),
+		InvitedBy: &user.Id,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	if err := app.models.ListShares.InsertInvitation(&invitation); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to share list",
+		})
+	}
+
+	link := fmt.Sprintf("%s/shares/accept?token=%s", app.appURL, url.QueryEscape(token))
+	listName := list.Name
+	app.background(func() {
+		app.sendInvitation(invitation.Email,
+			fmt.Sprintf("%s shared \"%s\" with you", user.Name, listName),
+			fmt.Sprintf("%s has shared the list \"%s\" with you with %s access.", user.Name, listName, invitation.Role),
+			link)
+	})
+
+	return c.JSON(http.StatusCreated, invitation)
+}
+
+// @Summary Change a share
+// @Description Changes the role a list is shared with. Only users who can manage the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "List ID"
+// @Param userId path string true "User ID"
+// @Param body body main.UpdateShareRequest true "Role"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/shares/{userId} [patch]
+func (app *application) handleUpdateListShare(c echo.Context) error {
+	var input UpdateShareRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	err := app.models.ListShares.UpdateRole(listFromContext(c).Id, c.Param("userId"), input.Role)
+	if err != nil {
+		return app.shareChangeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Stop sharing a list
+// @Description Removes a user's access to a list. Users who can manage the list can remove anyone; everyone else can only remove themselves.
+// @Tags sharing
+// @Security BearerAuth
+// @Param id path string true "List ID"
+// @Param userId path string true "User ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/shares/{userId} [delete]
+func (app *application) handleDeleteListShare(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	listId := c.Param("id")
+	userId := c.Param("userId")
+
+	if userId != user.Id {
+		ok, err := app.models.Lists.CanManage(listId, user.Id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    ErrInternal,
+				Message: "Failed to remove share",
+			})
+		}
+		if !ok {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Share not found",
+			})
+		}
+	}
+
+	if err := app.models.ListShares.Delete(listId, userId); err != nil {
+		return app.shareChangeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (app *application) shareChangeError(c echo.Context, err error) error {
+	if err.Error() == "share not found" {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Share not found",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Code:    ErrInternal,
+		Message: "Failed to update share",
+	})
+}
+
+// @Summary Cancel a share invitation
+// @Description Cancels a pending share invitation. Only users who can manage the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Param id path string true "List ID"
+// @Param invitationId path string true "Invitation ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/shares/invitations/{invitationId} [delete]
+func (app *application) handleDeleteShareInvitation(c echo.Context) error {
+	err := app.models.ListShares.DeleteInvitation(c.Param("invitationId"), listFromContext(c).Id)
+	if err != nil {
+		if err.Error() == "invitation not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Invitation not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to cancel invitation",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Accept a share invitation
+// @Description Gives the authenticated user access to the list a share invitation is for. The invitation must have been sent to their email address.
+// @Tags sharing
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.AcceptInvitationRequest true "Invitation token"
+// @Success 200 {object} database.SharedList
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Invitation is for another email address"
+// @Router /api/v1/shares/accept [post]
+func (app *application) handleAcceptShareInvitation(c echo.Context) error {
+	var input AcceptInvitationRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	invitation, err := app.models.ListShares.GetPendingInvitationByHash(utils.HashToken(input.Token))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to accept invitation",
+		})
+	}
+	if invitation == nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Invitation is invalid or has expired",
+		})
+	}
+
+	user := app.GetUserFromContext(c)
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrForbidden,
+			Message: "This invitation was sent to a different email address",
+		})
+	}
+	if user.EmailVerifiedAt == nil {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrEmailNotVerified,
+			Message: "Please verify your email address before accepting the invitation",
+		})
+	}
+
+	if err := app.models.ListShares.AcceptInvitation(invitation, user.Id); err != nil {
+		if err.Error() == "invitation not found" {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    ErrInvalidToken,
+				Message: "Invitation is invalid or has expired",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to accept invitation",
+		})
+	}
+
+	shared, err := app.models.ListShares.GetSharedList(invitation.ListId, user.Id)
+	if err != nil || shared == nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to accept invitation",
+		})
+	}
+	return c.JSON(http.StatusOK, shared)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary List lists
+// @Description Lists the personal lists of the authenticated user, the lists of their organisations and the lists shared with them.
+// @Tags lists
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} database.List
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/lists [get]
+func (app *application) handleGetLists(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	lists, err := app.models.Lists.GetAllForUser(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch lists",
+		})
+	}
+	return c.JSON(http.StatusOK, lists)
+}
+
+// @Summary Create a list
+// @Description Creates a personal list, or a list in an organisation the authenticated user is a member of.
+// @Tags lists
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body database.ListCreate true "List"
+// @Success 201 {object} database.List
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Guests cannot create lists"
+// @Failure 404 {object} main.ErrorResponse "Organisation not found"
+// @Router /api/v1/lists [post]
+func (app *application) handleCreateList(c echo.Context) error {
+	var input database.ListCreate
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	list := database.List{Name: input.Name}
+
+	if input.OrganisationId == nil {
+		list.OwnerId = &user.Id
+	} else {
+		membership, err := app.models.Organisations.GetMembership(*input.OrganisationId, user.Id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    ErrInternal,
+				Message: "Failed to create list",
+			})
+		}
+		if membership == nil {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Organisation not found",
+			})
+		}
+		if !database.OrgRoleAtLeast(membership.Role, database.OrgRoleMember) {
+			return c.JSON(http.StatusForbidden, ErrorResponse{
+				Code:    ErrForbidden,
+				Message: "You do not have permission to do this",
+			})
+		}
+		list.OrganisationId = input.OrganisationId
+	}
+
+	if err := app.models.Lists.Insert(&list); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create list",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, list)
+}
+
+// @Summary Get a list
+// @Description Returns a list the authenticated user can read.
+// @Tags lists
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "List ID"
+// @Success 200 {object} database.List
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id} [get]
+func (app *application) handleGetList(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	list, err := app.models.Lists.Get(c.Param("id"), user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch list",
+		})
+	}
+	if list == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "List not found",
+		})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// @Summary Rename a list
+// @Description Renames a list the authenticated user can write to.
+// @Tags lists
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "List ID"
+// @Param body body database.ListPatch true "List"
+// @Success 200 {object} database.List
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id} [patch]
+func (app *application) handleUpdateList(c echo.Context) error {
+	var input database.ListPatch
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	list, err := app.models.Lists.Rename(c.Param("id"), input.Name, user.Id)
+	if err != nil {
+		if err.Error() == "list not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "List not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update list",
+		})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// @Summary Delete a list
+// @Description Deletes a list and its todos. Personal lists can be deleted by their owner and anyone they were shared with as owner, organisation lists by the organisation's owners and admins.
+// @Tags lists
+// @Security BearerAuth
+// @Param id path string true "List ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id} [delete]
+func (app *application) handleDeleteList(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	if err := app.models.Lists.Delete(c.Param("id"), user.Id); err != nil {
+		if err.Error() == "list not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "List not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete list",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
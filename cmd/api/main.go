@@ -3,12 +3,26 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/janst44/go-react-todo/internal/blob"
 	"github.com/janst44/go-react-todo/internal/database"
 	"github.com/janst44/go-react-todo/internal/database/env"
+	"github.com/janst44/go-react-todo/internal/jwtkeys"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/notify"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/janst44/go-react-todo/internal/webpush"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // @title Go Web API
@@ -23,9 +37,68 @@ import (
 // @description Enter your bearer token in the format "Bearer <token>".
 
 type application struct {
-	port      int
-	jwtSecret string
-	models    database.Models
+	port        int
+	jwtKeys     *jwtkeys.KeySet
+	jwtIssuer   string
+	jwtAudience string
+	jwtLeeway   time.Duration
+	tokenSecret string
+	appURL      string
+	corsOrigins []string
+	totpIssuer  string
+	models      database.Models
+	validator   *utils.CustomValidator
+	mailer      mailer.Mailer
+	blobs       blob.Store
+	notifier    *notify.Notifier
+	vapid       *webpush.VAPID
+	webAuthn    *webauthn.WebAuthn
+
+	oidcProviders map[string]*oidcProvider
+
+	requireEmailVerification bool
+
+	// commentEditWindow is how long after posting authors can edit comments
+	commentEditWindow time.Duration
+	// undoTTL is how long a mutation can be undone
+	undoTTL time.Duration
+
+	attachmentMaxBytes      int64
+	attachmentTypes         []string
+	attachmentSweepInterval time.Duration
+
+	reminderPollInterval time.Duration
+
+	// pushServiceHosts are the push services browsers may subscribe with;
+	// subdomains are allowed too
+	pushServiceHosts []string
+
+	// notificationListener hears about notifications added by any API
+	// process, which notificationHub passes on to the streams open here
+	notificationListener *pq.Listener
+	notificationHub      *notify.Hub
+
+	// cookieAuth makes logins set an HttpOnly session cookie instead of
+	// returning the JWT in the response body.
+	cookieAuth     bool
+	cookieSameSite http.SameSite
+	cookieDomain   string
+
+	// trustedProxies may set X-Forwarded-For; with none the peer address
+	// of the connection is the client's
+	trustedProxies []*net.IPNet
+
+	passwordResetIPLimiter    *utils.KeyedLimiter
+	passwordResetEmailLimiter *utils.KeyedLimiter
+	verificationIPLimiter     *utils.KeyedLimiter
+	verificationEmailLimiter  *utils.KeyedLimiter
+	mfaLimiter                *utils.KeyedLimiter
+	publicLinkLimiter         *utils.KeyedLimiter
+
+	loginIPFailures      *utils.FailureTracker
+	loginAccountFailures *utils.FailureTracker
+
+	sessionCache *utils.SessionCache
 }
 
 func main() {
@@ -54,13 +127,261 @@ func main() {
 
 	models := database.NewModels(db)
 
+	// ADMIN_EMAILS bootstraps the first administrators; after that admins
+	// can be managed from the database.
+	if adminEmails := env.GetEnv("ADMIN_EMAILS", ""); adminEmails != "" {
+		emails := strings.Split(strings.ToLower(adminEmails), ",")
+		for i := range emails {
+			emails[i] = strings.TrimSpace(emails[i])
+		}
+		if err := models.Users.PromoteToAdmin(emails); err != nil {
+			fmt.Printf("Error promoting admins: %v\n", err)
+			return
+		}
+	}
+
+	mail, err := newMailer()
+	if err != nil {
+		fmt.Printf("Error configuring mailer: %v\n", err)
+		return
+	}
+
+	blobs, err := newBlobStore()
+	if err != nil {
+		fmt.Printf("Error configuring blob storage: %v\n", err)
+		return
+	}
+
+	appURL := env.GetEnv("APP_URL", "http://localhost:3000")
+
+	vapid, err := newVAPID(appURL)
+	if err != nil {
+		fmt.Printf("Error configuring web push: %v\n", err)
+		return
+	}
+
+	listener := pq.NewListener(dbURL, 10*time.Second, time.Minute, nil)
+	defer listener.Close()
+	if err := listener.Listen(database.NotificationsChannel); err != nil {
+		fmt.Printf("Error listening for notifications: %v\n", err)
+		return
+	}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:                  env.GetEnv("WEBAUTHN_RP_ID", "localhost"),
+		RPDisplayName:         env.GetEnv("WEBAUTHN_RP_NAME", "Go React Todo"),
+		RPOrigins:             strings.Split(env.GetEnv("WEBAUTHN_RP_ORIGINS", appURL), ","),
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+	if err != nil {
+		fmt.Printf("Error configuring WebAuthn: %v\n", err)
+		return
+	}
+
+	oidcProviders, err := loadOIDCProviders(env.GetEnv("API_URL", "http://localhost:8080"))
+	if err != nil {
+		fmt.Printf("Error configuring OIDC providers: %v\n", err)
+		return
+	}
+
+	trustedProxies, err := parseTrustedProxies(env.GetEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		fmt.Printf("Error configuring trusted proxies: %v\n", err)
+		return
+	}
+
+	// Anything but an explicit APP_ENV=development counts as production, so
+	// forgetting to set it cannot leave a deployment on the default secret
+	appEnv := env.GetEnv("APP_ENV", "production")
+
+	jwtKeys, usingDefaultSecret, err := loadJWTKeys()
+	if err != nil {
+		fmt.Printf("Error loading JWT keys: %v\n", err)
+		return
+	}
+
+	tokenSecret := env.GetEnv("TOKEN_SECRET", env.GetEnv("JWT_SECRET", defaultSecret))
+	if appEnv != "development" && (usingDefaultSecret || tokenSecret == defaultSecret) {
+		fmt.Println("Error: refusing to start with the default secret outside development; set JWT_SECRET or JWT_SIGNING_KEY_FILE and TOKEN_SECRET")
+		return
+	}
+
 	app := &application{
-		port:      env.GetEnvInt("PORT", 8080),
-		jwtSecret: env.GetEnv("JWT_SECRET", "default_secret"),
-		models:    models,
+		port:        env.GetEnvInt("PORT", 8080),
+		jwtKeys:     jwtKeys,
+		jwtIssuer:   env.GetEnv("JWT_ISSUER", "go-react-todo"),
+		jwtAudience: env.GetEnv("JWT_AUDIENCE", "go-react-todo-api"),
+		jwtLeeway:   env.GetEnvDuration("JWT_CLOCK_SKEW", 30*time.Second),
+		tokenSecret: tokenSecret,
+		appURL:      appURL,
+		corsOrigins: strings.Split(env.GetEnv("CORS_ALLOWED_ORIGINS", appURL), ","),
+		totpIssuer:  env.GetEnv("TOTP_ISSUER", "Go React Todo"),
+		models:      models,
+		validator:   utils.NewValidator(),
+		mailer:      mail,
+		blobs:       blobs,
+		notifier:    newNotifier(&models, mail, vapid),
+		vapid:       vapid,
+		webAuthn:    webAuthn,
+
+		oidcProviders: oidcProviders,
+
+		requireEmailVerification: env.GetEnvBool("REQUIRE_EMAIL_VERIFICATION", false),
+
+		commentEditWindow: env.GetEnvDuration("COMMENT_EDIT_WINDOW", 15*time.Minute),
+		undoTTL:           env.GetEnvDuration("UNDO_TTL", time.Hour),
+
+		attachmentMaxBytes:      int64(env.GetEnvInt("ATTACHMENT_MAX_MB", 10)) << 20,
+		attachmentTypes:         strings.Split(env.GetEnv("ATTACHMENT_ALLOWED_TYPES", "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain"), ","),
+		attachmentSweepInterval: env.GetEnvDuration("ATTACHMENT_SWEEP_INTERVAL", 5*time.Minute),
+
+		reminderPollInterval: env.GetEnvDuration("REMINDER_POLL_INTERVAL", 30*time.Second),
+
+		pushServiceHosts: strings.Split(env.GetEnv("PUSH_SERVICE_HOSTS",
+			"fcm.googleapis.com,push.services.mozilla.com,push.apple.com,notify.windows.com"), ","),
+
+		notificationListener: listener,
+		notificationHub:      notify.NewHub(),
+
+		cookieAuth:     env.GetEnvBool("AUTH_COOKIES", false),
+		cookieSameSite: parseSameSite(env.GetEnv("COOKIE_SAMESITE", "lax")),
+		cookieDomain:   env.GetEnv("COOKIE_DOMAIN", ""),
+
+		trustedProxies: trustedProxies,
+
+		passwordResetIPLimiter:    utils.NewKeyedLimiter(12*time.Second, 5),
+		passwordResetEmailLimiter: utils.NewKeyedLimiter(20*time.Minute, 3),
+		verificationIPLimiter:     utils.NewKeyedLimiter(12*time.Second, 5),
+		verificationEmailLimiter:  utils.NewKeyedLimiter(20*time.Minute, 3),
+		mfaLimiter:                utils.NewKeyedLimiter(12*time.Second, 5),
+		publicLinkLimiter:         utils.NewKeyedLimiter(6*time.Second, 10),
+
+		// Lockouts start at a minute and double with every further failure
+		loginIPFailures:      utils.NewFailureTracker(env.GetEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20), time.Minute, time.Hour),
+		loginAccountFailures: utils.NewFailureTracker(env.GetEnvInt("LOGIN_MAX_FAILURES_PER_ACCOUNT", 5), time.Minute, time.Hour),
+
+		sessionCache: utils.NewSessionCache(env.GetEnvDuration("SESSION_CACHE_TTL", 30*time.Second)),
 	}
 
 	if err := app.serve(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// defaultSecret is only good enough for local development.
+const defaultSecret = "default_secret"
+
+// loadJWTKeys builds the key set tokens are signed and verified with. When
+// JWT_SIGNING_KEY_FILE names an RSA or Ed25519 private key it signs new
+// tokens; otherwise tokens are signed with HS256 and JWT_SECRET. Keys listed
+// in JWT_VERIFICATION_KEY_FILES, and JWT_SECRET if it is set, keep verifying
+// older tokens while a key is being rotated out. The boolean result reports
+// whether the built-in default secret is in use.
+func loadJWTKeys() (*jwtkeys.KeySet, bool, error) {
+	var hmacKey *jwtkeys.Key
+	if secret := env.GetEnv("JWT_SECRET", ""); secret != "" {
+		hmacKey = jwtkeys.NewHMACKey("hs256", []byte(secret))
+	}
+
+	var verification []*jwtkeys.Key
+	for _, path := range strings.Split(env.GetEnv("JWT_VERIFICATION_KEY_FILES", ""), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := jwtkeys.LoadKeyFile(path)
+		if err != nil {
+			return nil, false, err
+		}
+		verification = append(verification, key)
+	}
+
+	signingPath := env.GetEnv("JWT_SIGNING_KEY_FILE", "")
+	if signingPath == "" {
+		usingDefault := hmacKey == nil
+		if usingDefault {
+			hmacKey = jwtkeys.NewHMACKey("hs256", []byte(defaultSecret))
+		}
+		keys, err := jwtkeys.NewKeySet(hmacKey, verification...)
+		return keys, usingDefault, err
+	}
+
+	signing, err := jwtkeys.LoadKeyFile(signingPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if hmacKey != nil {
+		verification = append(verification, hmacKey)
+	}
+	keys, err := jwtkeys.NewKeySet(signing, verification...)
+	return keys, false, err
+}
+
+// newMailer picks the mail transport from MAILER. "smtp" relays through
+// SMTP_HOST; anything else logs messages to MAIL_LOG_FILE, or stdout when
+// no file is set.
+func newMailer() (mailer.Mailer, error) {
+	if env.GetEnv("MAILER", "log") == "smtp" {
+		return mailer.NewSMTPMailer(
+			env.GetEnv("SMTP_HOST", "localhost"),
+			env.GetEnvInt("SMTP_PORT", 587),
+			env.GetEnv("SMTP_USERNAME", ""),
+			env.GetEnv("SMTP_PASSWORD", ""),
+			env.GetEnv("SMTP_FROM", "no-reply@localhost"),
+		), nil
+	}
+
+	var out io.Writer = os.Stdout
+	if path := env.GetEnv("MAIL_LOG_FILE", ""); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	return mailer.NewLogMailer(out), nil
+}
+
+// newBlobStore picks where attachments are kept from BLOB_STORE. "s3"
+// uses the S3_BUCKET bucket at S3_ENDPOINT, which can be any S3-compatible
+// service; anything else keeps files under BLOB_DIR.
+func newBlobStore() (blob.Store, error) {
+	if env.GetEnv("BLOB_STORE", "local") == "s3" {
+		return blob.NewS3Store(
+			env.GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			env.GetEnv("S3_REGION", "us-east-1"),
+			env.GetEnv("S3_BUCKET", ""),
+			env.GetEnv("S3_ACCESS_KEY", ""),
+			env.GetEnv("S3_SECRET_KEY", ""),
+		), nil
+	}
+	return blob.NewLocalStore(env.GetEnv("BLOB_DIR", "./data/blobs"))
+}
+
+// newVAPID loads the key web push messages are signed with from
+// VAPID_PRIVATE_KEY. Web push is off when it is not set.
+func newVAPID(appURL string) (*webpush.VAPID, error) {
+	key := env.GetEnv("VAPID_PRIVATE_KEY", "")
+	if key == "" {
+		return nil, nil
+	}
+	return webpush.NewVAPID(key, env.GetEnv("VAPID_SUBJECT", appURL))
+}
+
+// newNotifier delivers notifications to the in-app inbox and by email, and
+// by web push if it is configured, as far as users' preferences allow.
+func newNotifier(models *database.Models, mail mailer.Mailer, vapid *webpush.VAPID) *notify.Notifier {
+	channels := []notify.Channel{
+		&notify.InboxChannel{Notifications: &models.Notifications},
+		&notify.EmailChannel{Mailer: mail},
+	}
+	if vapid != nil {
+		channels = append(channels, &notify.WebPushChannel{
+			VAPID:         vapid,
+			Subscriptions: &models.PushSubscriptions,
+			Client:        webpush.NewClient(10 * time.Second),
+			TTL:           24 * time.Hour,
+		})
+	}
+	return notify.New(&models.NotificationPrefs, channels...)
+}
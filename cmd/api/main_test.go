@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/jwtkeys"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	testAppURL = "http://localhost:3000"
+	testAPIURL = "http://localhost:8080"
+)
+
+// newTestApp returns an application configured the way main does for local
+// development. It has no database; tests that need one call useTestDB.
+func newTestApp(t *testing.T) *application {
+	t.Helper()
+
+	jwtKeys, err := jwtkeys.NewKeySet(jwtkeys.NewHMACKey("hs256", []byte("test-jwt-secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:                  "localhost",
+		RPDisplayName:         "Go React Todo",
+		RPOrigins:             []string{testAppURL},
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &application{
+		jwtKeys:     jwtKeys,
+		jwtIssuer:   "go-react-todo",
+		jwtAudience: "go-react-todo-api",
+		jwtLeeway:   30 * time.Second,
+		tokenSecret: "test-token-secret",
+		appURL:      testAppURL,
+		corsOrigins: []string{testAppURL},
+		totpIssuer:  "Go React Todo",
+		validator:   utils.NewValidator(),
+		mailer:      mailer.NewLogMailer(io.Discard),
+		webAuthn:    webAuthn,
+
+		oidcProviders: map[string]*oidcProvider{},
+
+		passwordResetIPLimiter:    utils.NewKeyedLimiter(12*time.Second, 5),
+		passwordResetEmailLimiter: utils.NewKeyedLimiter(20*time.Minute, 3),
+		verificationIPLimiter:     utils.NewKeyedLimiter(12*time.Second, 5),
+		verificationEmailLimiter:  utils.NewKeyedLimiter(20*time.Minute, 3),
+		mfaLimiter:                utils.NewKeyedLimiter(12*time.Second, 5),
+		publicLinkLimiter:         utils.NewKeyedLimiter(6*time.Second, 10),
+
+		loginIPFailures:      utils.NewFailureTracker(20, time.Minute, time.Hour),
+		loginAccountFailures: utils.NewFailureTracker(5, time.Minute, time.Hour),
+
+		sessionCache: utils.NewSessionCache(30 * time.Second),
+	}
+}
+
+// useTestDB gives app a database of its own: a new schema in the Postgres
+// database named by TEST_DATABASE_URL with every migration applied. The test
+// is skipped when TEST_DATABASE_URL is not set.
+func useTestDB(t *testing.T, app *application) {
+	t.Helper()
+
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(t, dbURL, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../../migrate/migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	for _, file := range files {
+		up, err := migrationUp(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("applying %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	app.models = database.NewModels(db)
+}
+
+// withSearchPath points every connection made with dbURL at schema. lib/pq
+// passes settings it does not know itself on to the server.
+func withSearchPath(t *testing.T, dbURL, schema string) string {
+	t.Helper()
+
+	if !strings.HasPrefix(dbURL, "postgres://") && !strings.HasPrefix(dbURL, "postgresql://") {
+		return dbURL + " search_path=" + schema
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// migrationUp returns the statements in the Up section of a goose migration.
+func migrationUp(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	_, up, ok := strings.Cut(string(data), "-- +goose Up")
+	if !ok {
+		return "", fmt.Errorf("%s has no Up section", filepath.Base(path))
+	}
+	up, _, _ = strings.Cut(up, "-- +goose Down")
+
+	var b strings.Builder
+	for _, line := range strings.Split(up, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "-- +goose") {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// createTestUser stores a user, with or without a verified email address.
+func createTestUser(t *testing.T, app *application, email string, verified bool) *database.User {
+	t.Helper()
+
+	user := &database.User{Email: email, Password: "not-a-bcrypt-hash", Name: "Test User"}
+	if err := app.models.Users.Insert(user); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if verified {
+		if err := app.models.Users.MarkEmailVerified(user.Id); err != nil {
+			t.Fatalf("verifying user: %v", err)
+		}
+	}
+
+	user, err := app.models.Users.Get(user.Id)
+	if err != nil || user == nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	return user
+}
+
+// testToken signs userId in and returns the JWT for the new session.
+func testToken(t *testing.T, app *application, userId string) string {
+	t.Helper()
+
+	user, err := app.models.Users.Get(userId)
+	if err != nil || user == nil {
+		t.Fatalf("loading user %s: %v", userId, err)
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	token, err := app.generateToken(c, user)
+	if err != nil {
+		t.Fatalf("signing in: %v", err)
+	}
+	return token
+}
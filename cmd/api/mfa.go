@@ -0,0 +1,437 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/totp"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	mfaChallengePurpose = "mfa-challenge"
+	mfaChallengeTTL     = 5 * time.Minute
+	recoveryCodeCount   = 10
+)
+
+// TOTPEnrollmentResponse contains what an authenticator app needs to add the account
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	URI    string `json:"uri" example:"otpauth://totp/Todo:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Todo"`
+	QRCode string `json:"qrCode" example:"data:image/png;base64,iVBORw0KGgo..."`
+}
+
+// TOTPCodeRequest represents a payload carrying a one-time code
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+// DisableTOTPRequest represents the disable two-factor payload
+type DisableTOTPRequest struct {
+	Password string `json:"password" validate:"required" example:"secret123"`
+}
+
+// RecoveryCodesResponse lists freshly generated recovery codes. They are only shown once.
+type RecoveryCodesResponse struct {
+	Codes []string `json:"codes" example:"k3j9d-pq2xa"`
+}
+
+// MFALoginRequest represents the second step of a two-factor login
+type MFALoginRequest struct {
+	MFAToken string `json:"mfaToken" validate:"required" example:"eyJ1c2VySWQiOi..."`
+	Code     string `json:"code" validate:"required" example:"123456"`
+}
+
+// generateMFAChallenge returns the short-lived token a user exchanges, along
+// with a second factor, for a real JWT once their password has been checked.
+// It carries the user's token version, so a password reset voids it like any
+// other token.
+func (app *application) generateMFAChallenge(user *database.User) string {
+	return utils.SignToken(
+		[]byte(app.tokenSecret),
+		mfaChallengePurpose+":"+user.Id+":"+strconv.Itoa(user.TokenVersion),
+		time.Now().Add(mfaChallengeTTL),
+	)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code for the user.
+func (app *application) verifySecondFactor(user *database.User, code string) (bool, error) {
+	if user.TOTPSecret == nil || user.TOTPEnabledAt == nil {
+		return false, nil
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(*user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return app.models.Users.UseTOTPStep(user.Id, step)
+	}
+
+	return app.models.RecoveryCodes.Consume(user.Id, utils.HashToken(normalizeRecoveryCode(code)))
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the
+// new ones in plain text.
+func (app *application) generateRecoveryCodes(userId string) ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = utils.HashToken(raw)
+	}
+
+	if err := app.models.RecoveryCodes.Replace(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// @Summary Start TOTP enrollment
+// @Description Generates a new TOTP secret for the authenticated user. Two-factor login is only switched on once the secret is confirmed with a code.
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} main.TOTPEnrollmentResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Failure 409 {object} main.ErrorResponse
+// @Router /api/v1/me/mfa/totp [post]
+func (app *application) handleEnrollTOTP(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	if user.TOTPEnabledAt != nil {
+		return c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    ErrConflict,
+			Message: "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start enrollment",
+		})
+	}
+
+	if err := app.models.Users.SetPendingTOTPSecret(user.Id, secret); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start enrollment",
+		})
+	}
+
+	uri := totp.URI(app.totpIssuer, user.Email, secret)
+	png, err := totp.QRCode(uri, 256)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start enrollment",
+		})
+	}
+
+	return c.JSON(http.StatusOK, TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// @Summary Confirm TOTP enrollment
+// @Description Turns on two-factor authentication once the user proves their authenticator app works, and returns a set of single-use recovery codes.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.TOTPCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} main.RecoveryCodesResponse
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/me/mfa/totp/confirm [post]
+func (app *application) handleConfirmTOTP(c echo.Context) error {
+	var input TOTPCodeRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	if !app.mfaLimiter.Allow(user.Id) {
+		return app.rateLimitedResponse(c)
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    ErrConflict,
+			Message: "Two-factor authentication is already enabled",
+		})
+	}
+	if user.TOTPSecret == nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrValidationFailed,
+			Message: "Start enrollment before confirming it",
+		})
+	}
+
+	step, ok := totp.Validate(*user.TOTPSecret, input.Code, time.Now())
+	if ok {
+		ok, _ = app.models.Users.UseTOTPStep(user.Id, step)
+	}
+	if !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidMFACode,
+			Message: "Invalid code",
+		})
+	}
+
+	if err := app.models.Users.EnableTOTP(user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to enable two-factor authentication",
+		})
+	}
+
+	codes, err := app.generateRecoveryCodes(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to generate recovery codes",
+		})
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{Codes: codes})
+}
+
+// @Summary Disable TOTP
+// @Description Turns off two-factor authentication and discards the recovery codes.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.DisableTOTPRequest true "Current password"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {object} main.ErrorResponse
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/me/mfa/totp/disable [post]
+func (app *application) handleDisableTOTP(c echo.Context) error {
+	var input DisableTOTPRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrUnauthorized,
+			Message: "Current password is incorrect",
+		})
+	}
+
+	if err := app.models.Users.DisableTOTP(user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to disable two-factor authentication",
+		})
+	}
+	if err := app.models.RecoveryCodes.DeleteAllForUser(user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to disable two-factor authentication",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes. Requires a current code from the authenticator app.
+// @Tags account
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.TOTPCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} main.RecoveryCodesResponse
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/me/mfa/recovery-codes [post]
+func (app *application) handleRegenerateRecoveryCodes(c echo.Context) error {
+	var input TOTPCodeRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	if !app.mfaLimiter.Allow(user.Id) {
+		return app.rateLimitedResponse(c)
+	}
+
+	if user.TOTPEnabledAt == nil || len(strings.TrimSpace(input.Code)) != totp.Digits {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidMFACode,
+			Message: "Invalid code",
+		})
+	}
+
+	ok, err := app.verifySecondFactor(user, input.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to verify code",
+		})
+	}
+	if !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidMFACode,
+			Message: "Invalid code",
+		})
+	}
+
+	codes, err := app.generateRecoveryCodes(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to generate recovery codes",
+		})
+	}
+
+	return c.JSON(http.StatusOK, RecoveryCodesResponse{Codes: codes})
+}
+
+// @Summary Completes a two-factor login
+// @Description Exchanges the MFA challenge token returned by login, plus a TOTP or recovery code, for a JWT.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body main.MFALoginRequest true "Challenge token and code"
+// @Success 200 {object} main.LoginResponse
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {object} main.ErrorResponse
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/auth/login/mfa [post]
+func (app *application) loginMFA(c echo.Context) error {
+	var input MFALoginRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	payload, err := utils.VerifyToken([]byte(app.tokenSecret), input.MFAToken)
+	if err != nil {
+		code := ErrInvalidToken
+		if errors.Is(err, utils.ErrTokenExpired) {
+			code = ErrTokenExpired
+		}
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    code,
+			Message: "Login challenge is invalid or has expired",
+		})
+	}
+
+	challenge, ok := strings.CutPrefix(payload, mfaChallengePurpose+":")
+	userId, version, found := strings.Cut(challenge, ":")
+	if !ok || !found {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Login challenge is invalid or has expired",
+		})
+	}
+
+	if !app.mfaLimiter.Allow(userId) {
+		return app.rateLimitedResponse(c)
+	}
+
+	user, err := app.models.Users.Get(userId)
+	if err != nil || user == nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Login challenge is invalid or has expired",
+		})
+	}
+	if user.DisabledAt != nil {
+		return app.accountDisabledResponse(c)
+	}
+	if version != strconv.Itoa(user.TokenVersion) {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrTokenRevoked,
+			Message: "Login challenge has been revoked",
+		})
+	}
+
+	ok, err = app.verifySecondFactor(user, input.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to verify code",
+		})
+	}
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrInvalidMFACode,
+			Message: "Invalid code",
+		})
+	}
+
+	tokenString, err := app.generateToken(c, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Error generating token",
+		})
+	}
+
+	return app.loginResponse(c, tokenString)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/totp"
+)
+
+func TestLoginMFARejectsReplayedCode(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	handler := app.routes()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Users.SetPendingTOTPSecret(user.Id, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Users.EnableTOTP(user.Id); err != nil {
+		t.Fatal(err)
+	}
+	user, _ = app.models.Users.Get(user.Id)
+
+	step := totp.Step(time.Now())
+	code := func(step int64) string {
+		c, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	login := func(t *testing.T, code string, wantStatus int) {
+		t.Helper()
+		postJSON(t, handler, "/api/v1/auth/login/mfa", "", MFALoginRequest{
+			MFAToken: app.generateMFAChallenge(user),
+			Code:     code,
+		}, wantStatus, nil)
+	}
+
+	login(t, code(step), http.StatusOK)
+
+	t.Run("same step", func(t *testing.T) {
+		login(t, code(step), http.StatusUnauthorized)
+	})
+
+	t.Run("earlier step in the skew window", func(t *testing.T) {
+		login(t, code(step-1), http.StatusUnauthorized)
+	})
+
+	t.Run("later step", func(t *testing.T) {
+		login(t, code(step+1), http.StatusOK)
+	})
+}
@@ -1,71 +1,128 @@
 package main
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/janst44/go-react-todo/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
 func (app *application) AuthMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			var tokenString string
+			fromCookie := false
+
 			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader == "" {
-				return c.JSON(http.StatusUnauthorized, echo.Map{
-					"error": "Missing authorization header",
-				})
+			if authHeader != "" {
+				parts := strings.Split(authHeader, " ")
+				if len(parts) != 2 || parts[0] != "Bearer" {
+					return app.unauthorizedResponse(c, ErrUnauthorized, "Invalid authorization header format")
+				}
+				tokenString = parts[1]
+			} else if cookie, err := c.Cookie(sessionCookie); app.cookieAuth && err == nil && cookie.Value != "" {
+				tokenString = cookie.Value
+				fromCookie = true
+			}
+			if tokenString == "" {
+				return app.unauthorizedResponse(c, ErrUnauthorized, "Missing authorization header")
 			}
 
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				return c.JSON(http.StatusUnauthorized, echo.Map{
-					"error": "Invalid authorization header format",
+			if fromCookie && !validCSRF(c) {
+				return c.JSON(http.StatusForbidden, ErrorResponse{
+					Code:    ErrCSRFInvalid,
+					Message: "Missing or invalid CSRF token",
 				})
 			}
 
-			tokenString := parts[1]
-
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			if !fromCookie && strings.HasPrefix(tokenString, apiTokenPrefix) {
+				return app.authenticateAPIToken(c, next, tokenString)
+			}
 
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
+			claims, err := app.parseToken(tokenString)
+			if err != nil {
+				if errors.Is(err, jwt.ErrTokenExpired) {
+					return app.unauthorizedResponse(c, ErrTokenExpired, "Token has expired")
 				}
-				return []byte(app.jwtSecret), nil
-			})
-
-			if err != nil || !token.Valid {
-				return c.JSON(http.StatusUnauthorized, echo.Map{
-					"error": "Invalid token",
-				})
+				return app.unauthorizedResponse(c, ErrInvalidToken, "Invalid token")
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				return c.JSON(http.StatusUnauthorized, echo.Map{
-					"error": "Invalid token claims",
-				})
+			user, err := app.models.Users.Get(claims.Subject)
+			if err != nil || user == nil {
+				return app.unauthorizedResponse(c, ErrInvalidToken, "Invalid token")
+			}
+			if user.DisabledAt != nil {
+				return app.accountDisabledResponse(c)
 			}
 
-			// Check expiration
-			// if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
-			// 	return c.JSON(http.StatusUnauthorized, echo.Map{
-			// 		"error": "Token has expired",
-			// 	})
-			// }
-
-			userId := claims["userId"].(string)
+			// Tokens issued before a password reset are no longer valid
+			if claims.Version != user.TokenVersion {
+				return app.unauthorizedResponse(c, ErrTokenRevoked, "Token has been revoked")
+			}
 
-			user, err := app.models.Users.Get(userId)
+			active, err := app.sessionActive(claims.ID)
 			if err != nil {
-				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Unauthorized access"})
-
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Code:    ErrInternal,
+					Message: "Failed to check session",
+				})
+			}
+			if !active {
+				return app.unauthorizedResponse(c, ErrTokenRevoked, "Session has been signed out")
 			}
 
 			c.Set("user", user)
+			c.Set("claims", claims)
 
 			return next(c)
 		}
 	}
 }
+
+// RequireRole rejects users without the given role. It must run after
+// AuthMiddleware.
+func (app *application) RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if app.GetUserFromContext(c).Role != role {
+				return c.JSON(http.StatusForbidden, ErrorResponse{
+					Code:    ErrForbidden,
+					Message: "You do not have permission to do this",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// authenticateAPIToken handles requests that carry a personal access token
+// instead of a JWT. The token's scopes are stored for RequireScope.
+func (app *application) authenticateAPIToken(c echo.Context, next echo.HandlerFunc, tokenString string) error {
+	token, err := app.models.APITokens.GetActiveByHash(utils.HashToken(tokenString))
+	if err != nil || token == nil {
+		return app.unauthorizedResponse(c, ErrInvalidToken, "Invalid token")
+	}
+
+	user, err := app.models.Users.Get(token.UserId)
+	if err != nil || user == nil {
+		return app.unauthorizedResponse(c, ErrInvalidToken, "Invalid token")
+	}
+	if user.DisabledAt != nil {
+		return app.accountDisabledResponse(c)
+	}
+
+	app.background(func() {
+		if err := app.models.APITokens.Touch(token.Id); err != nil {
+			log.Printf("api token last used: %v", err)
+		}
+	})
+
+	c.Set("user", user)
+	c.Set("tokenScopes", token.Scopes)
+
+	return next(c)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/notify"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// notificationKeepAlive is how often an idle notification stream is
+	// written to, so that proxies do not close it
+	notificationKeepAlive = 25 * time.Second
+	// notificationStreamMaxAge is how long a notification stream stays
+	// open. Browsers reconnect on their own, which checks the session again.
+	notificationStreamMaxAge = 5 * time.Minute
+	// listenerPingInterval is how often the Postgres listener connection is
+	// checked when no notifications arrive
+	listenerPingInterval = 90 * time.Second
+)
+
+// NotificationsQuery pages through the inbox
+type NotificationsQuery struct {
+	Unread   bool `query:"unread" example:"true"`
+	Page     int  `query:"page" validate:"omitempty,min=1" example:"1"`
+	PageSize int  `query:"pageSize" validate:"omitempty,min=1,max=100" example:"20"`
+}
+
+// NotificationPage is a page of the inbox
+type NotificationPage struct {
+	Notifications []database.Notification `json:"notifications"`
+	Total         int                     `json:"total" example:"12"`
+	Unread        int                     `json:"unread" example:"3"`
+	Page          int                     `json:"page" example:"1"`
+	PageSize      int                     `json:"pageSize" example:"20"`
+}
+
+// NotificationPreferences turns each type of notification on or off per
+// channel, e.g. {"comment": {"email": false}}
+type NotificationPreferences struct {
+	Preferences map[string]map[string]bool `json:"preferences" validate:"required,dive,keys,oneof=reminder assigned todo_changed comment mention share_invite,endkeys,dive,keys,oneof=inbox email push,endkeys"`
+}
+
+// @Summary List notifications
+// @Description Lists the authenticated user's in-app notifications, newest first, with how many are unread.
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Param unread query bool false "Only list unread notifications"
+// @Param page query int false "Page, starting at 1"
+// @Param pageSize query int false "Notifications per page, at most 100"
+// @Success 200 {object} main.NotificationPage
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/notifications [get]
+func (app *application) handleGetNotifications(c echo.Context) error {
+	var input NotificationsQuery
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid query parameters",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	if input.Page == 0 {
+		input.Page = 1
+	}
+	if input.PageSize == 0 {
+		input.PageSize = 20
+	}
+
+	user := app.GetUserFromContext(c)
+	notifications, total, unread, err := app.models.Notifications.GetForUser(user.Id, input.Unread, input.PageSize, (input.Page-1)*input.PageSize)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch notifications",
+		})
+	}
+
+	return c.JSON(http.StatusOK, NotificationPage{
+		Notifications: notifications,
+		Total:         total,
+		Unread:        unread,
+		Page:          input.Page,
+		PageSize:      input.PageSize,
+	})
+}
+
+// @Summary Mark a notification read
+// @Description Marks one of the authenticated user's notifications read.
+// @Tags notifications
+// @Security BearerAuth
+// @Param id path string true "Notification ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/notifications/{id}/read [post]
+func (app *application) handleMarkNotificationRead(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	if err := app.models.Notifications.MarkRead(c.Param("id"), user.Id); err != nil {
+		if err.Error() == "notification not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Notification not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update notification",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Mark all notifications read
+// @Description Marks every unread notification of the authenticated user read.
+// @Tags notifications
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/notifications/read-all [post]
+func (app *application) handleMarkAllNotificationsRead(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	if err := app.models.Notifications.MarkAllRead(user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update notifications",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Stream notifications
+// @Description Streams the authenticated user's new notifications as server-sent events named "notification", each carrying the notification as JSON. It accepts a Bearer token or the session cookie like any other route; since EventSource cannot send an Authorization header, clients using tokens read it with fetch. The stream ends after a few minutes and should be reopened.
+// @Tags notifications
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/notifications/stream [get]
+func (app *application) handleNotificationStream(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	messages, unsubscribe := app.notificationHub.Subscribe(user.Id)
+	defer unsubscribe()
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(c.Response()).SetWriteDeadline(time.Time{}); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to open notification stream",
+		})
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(res, "retry: 5000\n\n"); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	keepAlive := time.NewTicker(notificationKeepAlive)
+	defer keepAlive.Stop()
+	maxAge := time.NewTimer(notificationStreamMaxAge)
+	defer maxAge.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-maxAge.C:
+			return nil
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(res, ": keep-alive\n\n")
+		case msg := <-messages:
+			_, err = fmt.Fprintf(res, "event: notification\ndata: %s\n\n", msg)
+		}
+		if err != nil {
+			return nil
+		}
+		res.Flush()
+	}
+}
+
+// relayNotifications passes the notifications announced by any API process
+// on to the streams open in this one.
+func (app *application) relayNotifications() {
+	for {
+		select {
+		case n := <-app.notificationListener.Notify:
+			// A nil notification means the connection was re-established;
+			// anything announced while it was down is only in the inbox
+			if n == nil {
+				continue
+			}
+			var event database.NotificationEvent
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				log.Printf("notification stream: %v", err)
+				continue
+			}
+			if !app.notificationHub.Subscribed(event.UserId) {
+				continue
+			}
+			notification, err := app.models.Notifications.Get(event.Id)
+			if err != nil || notification == nil {
+				log.Printf("notification stream: %s: %v", event.Id, err)
+				continue
+			}
+			msg, err := json.Marshal(notification)
+			if err != nil {
+				log.Printf("notification stream: %v", err)
+				continue
+			}
+			app.notificationHub.Publish(event.UserId, msg)
+		case <-time.After(listenerPingInterval):
+			go app.notificationListener.Ping()
+		}
+	}
+}
+
+// @Summary Get notification preferences
+// @Description Returns, for every type of notification, the channels it is sent over. Everything is on until turned off.
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} main.NotificationPreferences
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/me/notification-preferences [get]
+func (app *application) handleGetNotificationPreferences(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	prefs, err := app.notificationPreferences(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch notification preferences",
+		})
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
+
+// @Summary Update notification preferences
+// @Description Turns types of notification on or off per channel. Types and channels left out keep their setting. Channels are inbox, email and push.
+// @Tags notifications
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.NotificationPreferences true "Preferences to change"
+// @Success 200 {object} main.NotificationPreferences
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/me/notification-preferences [patch]
+func (app *application) handleUpdateNotificationPreferences(c echo.Context) error {
+	var input NotificationPreferences
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	changes := []database.NotificationPreference{}
+	for typ, channels := range input.Preferences {
+		for channel, enabled := range channels {
+			changes = append(changes, database.NotificationPreference{Type: typ, Channel: channel, Enabled: enabled})
+		}
+	}
+
+	user := app.GetUserFromContext(c)
+	if err := app.models.NotificationPrefs.Set(user.Id, changes); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update notification preferences",
+		})
+	}
+
+	prefs, err := app.notificationPreferences(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch notification preferences",
+		})
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
+
+// notificationPreferences fills in the user's saved preferences with the
+// defaults for every type and every channel notifications are sent over.
+func (app *application) notificationPreferences(userId string) (*NotificationPreferences, error) {
+	saved, err := app.models.NotificationPrefs.GetForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := &NotificationPreferences{Preferences: map[string]map[string]bool{}}
+	for _, typ := range notify.Types {
+		prefs.Preferences[typ] = map[string]bool{}
+		for _, channel := range app.notifier.ChannelNames() {
+			prefs.Preferences[typ][channel] = true
+		}
+	}
+	for _, p := range saved {
+		if _, ok := prefs.Preferences[p.Type][p.Channel]; ok {
+			prefs.Preferences[p.Type][p.Channel] = p.Enabled
+		}
+	}
+	return prefs, nil
+}
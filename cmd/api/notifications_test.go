@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/notify"
+)
+
+func TestNotificationStreamWithBearerToken(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	app.notificationHub = notify.NewHub()
+	srv := httptest.NewServer(app.routes())
+	defer srv.Close()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+
+	// The header EventSource cannot send, as the client's fetch does
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/notifications/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken(t, app, user.Id))
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, content type = %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); !app.notificationHub.Subscribed(user.Id); {
+		if time.Now().After(deadline) {
+			t.Fatal("the stream never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	app.notificationHub.Publish(user.Id, []byte(`{"id":"n1","title":"Reminder"}`))
+
+	lines := bufio.NewScanner(res.Body)
+	var event string
+	for lines.Scan() {
+		line := lines.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if event != "notification" || data != `{"id":"n1","title":"Reminder"}` {
+				t.Fatalf("event %q with data %s", event, data)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream ended without the notification: %v", lines.Err())
+}
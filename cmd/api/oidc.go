@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/database/env"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcFlowCookie  = "oidc_flow"
+	oidcFlowPurpose = "oidc-flow"
+	oidcFlowTTL     = 10 * time.Minute
+)
+
+var (
+	errOIDCEmailNotVerified  = errors.New("identity provider did not verify the email address")
+	errOIDCAccountUnverified = errors.New("account with the same email address has not been verified")
+)
+
+// oidcProvider is an OpenID Connect issuer users can sign in with. The
+// discovery document is fetched on first use so that an unreachable provider
+// does not stop the API from starting.
+type oidcProvider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	redirectURL  string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// oidcFlow is kept in a signed cookie between the redirect to the provider
+// and the callback.
+type oidcFlow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type oidcClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+}
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS. Each one is
+// configured through OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and optionally OIDC_<NAME>_SCOPES.
+func loadOIDCProviders(apiURL string) (map[string]*oidcProvider, error) {
+	providers := make(map[string]*oidcProvider)
+
+	for _, name := range strings.Split(env.GetEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := &oidcProvider{
+			name:         name,
+			issuer:       env.GetEnv(prefix+"ISSUER", ""),
+			clientID:     env.GetEnv(prefix+"CLIENT_ID", ""),
+			clientSecret: env.GetEnv(prefix+"CLIENT_SECRET", ""),
+			scopes:       strings.Fields(strings.ReplaceAll(env.GetEnv(prefix+"SCOPES", "openid email profile"), ",", " ")),
+			redirectURL:  fmt.Sprintf("%s/api/v1/auth/oidc/%s/callback", strings.TrimRight(apiURL, "/"), name),
+		}
+		if p.issuer == "" || p.clientID == "" {
+			return nil, fmt.Errorf("oidc provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers[name] = p
+	}
+
+	return providers, nil
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.issuer)
+		if err != nil {
+			return nil, fmt.Errorf("oidc discovery for %s failed: %w", p.name, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	scopes := p.scopes
+	if !containsString(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// emailVerified accepts both the boolean the spec requires and the string
+// some providers send instead.
+func (c oidcClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// oidcRedirect sends the browser back to the client. Results travel in the
+// URL fragment so they are never sent to a server or written to access logs.
+func (app *application) oidcRedirect(c echo.Context, values url.Values) error {
+	return c.Redirect(http.StatusFound, app.appURL+"/auth/callback#"+values.Encode())
+}
+
+func (app *application) oidcError(c echo.Context, code ErrorCode) error {
+	return app.oidcRedirect(c, url.Values{"error": {string(code)}})
+}
+
+// @Summary List SSO providers
+// @Description Lists the OpenID Connect providers users can sign in with.
+// @Tags auth
+// @Produce json
+// @Success 200 {array} string
+// @Router /api/v1/auth/oidc/providers [get]
+func (app *application) handleGetOIDCProviders(c echo.Context) error {
+	names := make([]string, 0, len(app.oidcProviders))
+	for name := range app.oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return c.JSON(http.StatusOK, names)
+}
+
+// @Summary Start SSO login
+// @Description Redirects the browser to the provider's authorization endpoint using the authorization code flow with PKCE.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302 {string} string "Found"
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 502 {object} main.ErrorResponse
+// @Router /api/v1/auth/oidc/{provider}/login [get]
+func (app *application) handleOIDCLogin(c echo.Context) error {
+	p, ok := app.oidcProviders[c.Param("provider")]
+	if !ok {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Unknown identity provider",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		log.Printf("oidc login: %v", err)
+		return c.JSON(http.StatusBadGateway, ErrorResponse{
+			Code:    ErrIdentityProvider,
+			Message: "Identity provider is unavailable",
+		})
+	}
+
+	state, err := utils.NewOpaqueToken(16)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Code: ErrInternal, Message: "Failed to start login"})
+	}
+	nonce, err := utils.NewOpaqueToken(16)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Code: ErrInternal, Message: "Failed to start login"})
+	}
+
+	flow := oidcFlow{
+		Provider: p.name,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	payload, err := json.Marshal(flow)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Code: ErrInternal, Message: "Failed to start login"})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    utils.SignToken([]byte(app.tokenSecret), oidcFlowPurpose+":"+string(payload), time.Now().Add(oidcFlowTTL)),
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		// Lax so the cookie survives the top-level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL := p.oauth2Config(provider).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(flow.Verifier),
+	)
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// @Summary Finish SSO login
+// @Description Handles the provider's redirect, verifies the ID token and redirects to the client with a JWT in the URL fragment. An existing account with the same email is only linked once its email address has been verified; until then the client receives EMAIL_NOT_VERIFIED.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 302 {string} string "Found"
+// @Router /api/v1/auth/oidc/{provider}/callback [get]
+func (app *application) handleOIDCCallback(c echo.Context) error {
+	p, ok := app.oidcProviders[c.Param("provider")]
+	if !ok {
+		return app.oidcError(c, ErrNotFound)
+	}
+
+	// The flow cookie is single use
+	c.SetCookie(&http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    "",
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if c.QueryParam("error") != "" {
+		log.Printf("oidc callback from %s: %s %s", p.name, c.QueryParam("error"), c.QueryParam("error_description"))
+		return app.oidcError(c, ErrIdentityProvider)
+	}
+
+	cookie, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+	payload, err := utils.VerifyToken([]byte(app.tokenSecret), cookie.Value)
+	if err != nil {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+	raw, ok := strings.CutPrefix(payload, oidcFlowPurpose+":")
+	if !ok {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal([]byte(raw), &flow); err != nil {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+	if flow.Provider != p.name || subtle.ConstantTimeCompare([]byte(flow.State), []byte(c.QueryParam("state"))) != 1 {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+
+	provider, err := p.discover(ctx)
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		return app.oidcError(c, ErrIdentityProvider)
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, c.QueryParam("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		log.Printf("oidc callback: code exchange with %s failed: %v", p.name, err)
+		return app.oidcError(c, ErrIdentityProvider)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return app.oidcError(c, ErrIdentityProvider)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.clientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		log.Printf("oidc callback: id token from %s rejected: %v", p.name, err)
+		return app.oidcError(c, ErrInvalidToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return app.oidcError(c, ErrInvalidToken)
+	}
+
+	user, err := app.resolveOIDCUser(p.name, idToken.Subject, claims)
+	if err != nil {
+		if errors.Is(err, errOIDCEmailNotVerified) || errors.Is(err, errOIDCAccountUnverified) {
+			return app.oidcError(c, ErrEmailNotVerified)
+		}
+		log.Printf("oidc callback: %v", err)
+		return app.oidcError(c, ErrInternal)
+	}
+
+	if user.DisabledAt != nil {
+		return app.oidcError(c, ErrAccountDisabled)
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return app.oidcRedirect(c, url.Values{"mfaToken": {app.generateMFAChallenge(user)}})
+	}
+
+	tokenString, err := app.generateToken(c, user)
+	if err != nil {
+		return app.oidcError(c, ErrInternal)
+	}
+
+	if app.cookieAuth {
+		csrfToken, err := app.setCSRFCookie(c)
+		if err != nil {
+			return app.oidcError(c, ErrInternal)
+		}
+		c.SetCookie(app.authCookie(sessionCookie, tokenString, int(tokenTTL.Seconds()), true))
+		return app.oidcRedirect(c, url.Values{"csrfToken": {csrfToken}})
+	}
+	return app.oidcRedirect(c, url.Values{"token": {tokenString}})
+}
+
+// resolveOIDCUser finds the user an external identity belongs to. Unknown
+// identities are linked to the account with the same email address, or a new
+// account is created, but only when the provider has verified that address.
+// Accounts whose owner has not verified the address are not linked: whoever
+// registered them may not own it, and would keep their password, passkeys
+// and tokens on an account the real owner then signs in to.
+func (app *application) resolveOIDCUser(provider string, subject string, claims oidcClaims) (*database.User, error) {
+	userId, err := app.models.Identities.GetUserId(provider, subject)
+	if err != nil {
+		return nil, err
+	}
+	if userId != "" {
+		user, err := app.models.Users.Get(userId)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			return user, nil
+		}
+	}
+
+	if claims.Email == "" || !claims.emailVerified() {
+		return nil, errOIDCEmailNotVerified
+	}
+
+	user, err := app.models.Users.GetByEmail(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil && user.EmailVerifiedAt == nil {
+		return nil, errOIDCAccountUnverified
+	}
+
+	if user == nil {
+		// SSO accounts get an unguessable password; the owner can set a real
+		// one through the password reset flow.
+		password, err := utils.NewOpaqueToken(32)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+
+		name := claims.Name
+		if name == "" {
+			name = claims.Email
+		}
+
+		user = &database.User{
+			Email:    claims.Email,
+			Password: string(hashedPassword),
+			Name:     name,
+		}
+		if err := app.models.Users.Insert(user); err != nil {
+			return nil, err
+		}
+
+		if err := app.models.Users.MarkEmailVerified(user.Id); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := app.models.Identities.Insert(user.Id, provider, subject, claims.Email); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCClientID     = "todo-app"
+	testOIDCClientSecret = "todo-app-secret"
+)
+
+// testIssuer is an OpenID Connect provider serving discovery, its signing
+// keys and a token endpoint that checks PKCE. Users are signed in at the
+// authorization endpoint by calling authorize.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// codes maps issued authorization codes to the request they answer
+	codes map[string]url.Values
+	// claims go into the next ID token
+	claims jwt.MapClaims
+	// signingKey signs ID tokens instead of key when set
+	signingKey *rsa.PrivateKey
+	// nonce replaces the nonce from the authorization request when set
+	nonce string
+	// exchanges counts the codes redeemed at the token endpoint
+	exchanges int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iss := &testIssuer{key: key, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", iss.handleDiscovery)
+	mux.HandleFunc("GET /jwks", iss.handleJWKS)
+	mux.HandleFunc("POST /token", iss.handleToken)
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func (iss *testIssuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                iss.URL,
+		"authorization_endpoint":                iss.URL + "/authorize",
+		"token_endpoint":                        iss.URL + "/token",
+		"jwks_uri":                              iss.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (iss *testIssuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	encode := base64.RawURLEncoding.EncodeToString
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   encode(iss.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(iss.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (iss *testIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.exchanges++
+
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID == "" {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	auth, ok := iss.codes[r.PostFormValue("code")]
+	delete(iss.codes, r.PostFormValue("code"))
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || clientID != testOIDCClientID || clientSecret != testOIDCClientSecret ||
+		r.PostFormValue("redirect_uri") != auth.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   iss.URL,
+		"aud":   testOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": auth.Get("nonce"),
+	}
+	if iss.nonce != "" {
+		claims["nonce"] = iss.nonce
+	}
+	for name, value := range iss.claims {
+		claims[name] = value
+	}
+
+	signingKey := iss.key
+	if iss.signingKey != nil {
+		signingKey = iss.signingKey
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(signingKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+// authorize plays the user signing in at the provider and returns the
+// query the provider redirects back to the API with.
+func (iss *testIssuer) authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != iss.URL+"/authorize" {
+		t.Fatalf("redirected to %s, want the authorization endpoint", got)
+	}
+	auth := u.Query()
+	if auth.Get("code_challenge_method") != "S256" || auth.Get("nonce") == "" {
+		t.Fatalf("authorization request without PKCE or nonce: %s", u.RawQuery)
+	}
+
+	code := rand.Text()
+	iss.mu.Lock()
+	iss.codes[code] = auth
+	iss.mu.Unlock()
+
+	return url.Values{"code": {code}, "state": {auth.Get("state")}}
+}
+
+func newOIDCTestApp(t *testing.T) (*application, *testIssuer) {
+	t.Helper()
+
+	iss := newTestIssuer(t)
+	app := newTestApp(t)
+	app.oidcProviders["test"] = &oidcProvider{
+		name:         "test",
+		issuer:       iss.URL,
+		clientID:     testOIDCClientID,
+		clientSecret: testOIDCClientSecret,
+		scopes:       []string{"openid", "email", "profile"},
+		redirectURL:  testAPIURL + "/api/v1/auth/oidc/test/callback",
+	}
+	return app, iss
+}
+
+// oidcSignIn runs the login and callback requests of the flow and returns
+// what the client receives in the URL fragment. tamper may change the query
+// the provider redirects back with.
+func oidcSignIn(t *testing.T, app *application, iss *testIssuer, tamper func(url.Values)) url.Values {
+	t.Helper()
+	handler := app.routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/test/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+
+	callback := iss.authorize(t, rec.Header().Get("Location"))
+	if tamper != nil {
+		tamper(callback)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/test/callback?"+callback.Encode(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	location, fragment, _ := strings.Cut(rec.Header().Get("Location"), "#")
+	if location != testAppURL+"/auth/callback" {
+		t.Fatalf("callback redirected to %s", location)
+	}
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	app, iss := newOIDCTestApp(t)
+	iss.claims = jwt.MapClaims{"sub": "user-1", "email": "ada@example.com", "email_verified": true}
+
+	got := oidcSignIn(t, app, iss, func(callback url.Values) {
+		callback.Set("state", "forged-state")
+	})
+	if got.Get("error") != string(ErrInvalidToken) {
+		t.Errorf("fragment = %v, want error %s", got, ErrInvalidToken)
+	}
+	if iss.exchanges != 0 {
+		t.Errorf("the code was redeemed %d times despite the wrong state", iss.exchanges)
+	}
+}
+
+func TestOIDCCallbackRejectsMissingFlowCookie(t *testing.T) {
+	app, iss := newOIDCTestApp(t)
+	handler := app.routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/test/login", nil))
+	callback := iss.authorize(t, rec.Header().Get("Location"))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/test/callback?"+callback.Encode(), nil))
+	if want := testAppURL + "/auth/callback#error=" + string(ErrInvalidToken); rec.Header().Get("Location") != want {
+		t.Errorf("redirected to %s, want %s", rec.Header().Get("Location"), want)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	app, iss := newOIDCTestApp(t)
+	iss.claims = jwt.MapClaims{"sub": "user-1", "email": "ada@example.com", "email_verified": true}
+	iss.nonce = "replayed-nonce"
+
+	got := oidcSignIn(t, app, iss, nil)
+	if got.Get("error") != string(ErrInvalidToken) {
+		t.Errorf("fragment = %v, want error %s", got, ErrInvalidToken)
+	}
+}
+
+func TestOIDCCallbackRejectsBadSignature(t *testing.T) {
+	app, iss := newOIDCTestApp(t)
+	iss.claims = jwt.MapClaims{"sub": "user-1", "email": "ada@example.com", "email_verified": true}
+
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.signingKey = forger
+
+	got := oidcSignIn(t, app, iss, nil)
+	if got.Get("error") != string(ErrInvalidToken) {
+		t.Errorf("fragment = %v, want error %s", got, ErrInvalidToken)
+	}
+}
+
+func TestOIDCLinksOnlyVerifiedEmails(t *testing.T) {
+	app, iss := newOIDCTestApp(t)
+	useTestDB(t, app)
+
+	verified := createTestUser(t, app, "verified@example.com", true)
+	unverified := createTestUser(t, app, "unverified@example.com", false)
+
+	tests := []struct {
+		name      string
+		claims    jwt.MapClaims
+		wantError ErrorCode
+		// wantUser is the account the identity should end up linked to;
+		// empty when no account should be linked
+		wantUser string
+	}{
+		{
+			name:     "verified account",
+			claims:   jwt.MapClaims{"sub": "verified", "email": verified.Email, "email_verified": true},
+			wantUser: verified.Id,
+		},
+		{
+			name:      "account never verified",
+			claims:    jwt.MapClaims{"sub": "unverified", "email": unverified.Email, "email_verified": true},
+			wantError: ErrEmailNotVerified,
+		},
+		{
+			name:      "provider did not verify the email",
+			claims:    jwt.MapClaims{"sub": "unverified-claim", "email": verified.Email, "email_verified": false},
+			wantError: ErrEmailNotVerified,
+		},
+		{
+			name:      "provider sent no email",
+			claims:    jwt.MapClaims{"sub": "no-email"},
+			wantError: ErrEmailNotVerified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss.claims = tt.claims
+			got := oidcSignIn(t, app, iss, nil)
+
+			if got.Get("error") != string(tt.wantError) {
+				t.Fatalf("fragment = %v, want error %q", got, tt.wantError)
+			}
+			if tt.wantError == "" && got.Get("token") == "" {
+				t.Fatalf("fragment = %v, want a token", got)
+			}
+
+			userId, err := app.models.Identities.GetUserId("test", tt.claims["sub"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userId != tt.wantUser {
+				t.Errorf("identity linked to %q, want %q", userId, tt.wantUser)
+			}
+		})
+	}
+
+	t.Run("new account", func(t *testing.T) {
+		iss.claims = jwt.MapClaims{"sub": "new", "email": "new@example.com", "email_verified": "true", "name": "New User"}
+		got := oidcSignIn(t, app, iss, nil)
+		if got.Get("token") == "" {
+			t.Fatalf("fragment = %v, want a token", got)
+		}
+
+		user, err := app.models.Users.GetByEmail("new@example.com")
+		if err != nil || user == nil {
+			t.Fatalf("new account not created: %v", err)
+		}
+		if user.EmailVerifiedAt == nil {
+			t.Error("new account's email address is not verified")
+		}
+		if userId, _ := app.models.Identities.GetUserId("test", "new"); userId != user.Id {
+			t.Errorf("identity linked to %q, want %q", userId, user.Id)
+		}
+	})
+
+	// Once linked, the identity keeps signing in to the same account
+	t.Run("linked identity", func(t *testing.T) {
+		iss.claims = jwt.MapClaims{"sub": "verified", "email": "changed@example.com", "email_verified": false}
+		got := oidcSignIn(t, app, iss, nil)
+		if got.Get("token") == "" {
+			t.Fatalf("fragment = %v, want a token", got)
+		}
+	})
+}
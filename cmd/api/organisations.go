@@ -0,0 +1,586 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/notify"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// sendInvitation tells the invitee about an invitation to accept at link.
+// People who already have an account hear about it like about anything
+// else, everyone else by email.
+func (app *application) sendInvitation(email string, title string, summary string, link string) {
+	days := int(invitationTTL.Hours() / 24)
+
+	invitee, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		log.Printf("invitation: %v", err)
+	}
+	if invitee != nil && invitee.DisabledAt == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		err = app.notifier.Notify(ctx, &notify.Notification{
+			UserId: invitee.Id,
+			Name:   invitee.Name,
+			Email:  invitee.Email,
+			Type:   notify.TypeShareInvite,
+			Title:  title,
+			Body:   fmt.Sprintf("%s The invitation expires in %d days.", summary, days),
+			URL:    link,
+		})
+	} else {
+		err = app.mailer.Send(mailer.Message{
+			To:      email,
+			Subject: title,
+			Body: fmt.Sprintf("Hi,\n\n%s Open the link below to accept:\n\n%s\n\n"+
+				"The invitation expires in %d days. You will need to sign in or create an account with this email address.\n",
+				summary, link, days),
+		})
+	}
+	if err != nil {
+		log.Printf("invitation: %v", err)
+	}
+}
+
+// OrganisationRequest represents the create and rename organisation payload
+type OrganisationRequest struct {
+	Name string `json:"name" validate:"required,max=255" example:"Acme Inc."`
+}
+
+// OrganisationResponse is an organisation with its members
+type OrganisationResponse struct {
+	database.Membership
+	Members []database.Member `json:"members"`
+}
+
+// InvitationRequest represents the invite member payload
+type InvitationRequest struct {
+	Email string `json:"email" validate:"required,email,max=255" example:"sam@example.com"`
+	Role  string `json:"role" validate:"required,oneof=admin member guest" example:"member"`
+}
+
+// UpdateMemberRequest represents the change member role payload
+type UpdateMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member guest" example:"admin"`
+}
+
+// AcceptInvitationRequest represents the accept invitation payload
+type AcceptInvitationRequest struct {
+	Token string `json:"token" validate:"required" example:"q3X9..."`
+}
+
+// RequireOrgRole loads the authenticated user's membership of the
+// organisation in the :id path parameter and rejects users below minRole.
+// Non-members get a 404 so organisation ids cannot be probed.
+func (app *application) RequireOrgRole(minRole string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := app.GetUserFromContext(c)
+			membership, err := app.models.Organisations.GetMembership(c.Param("id"), user.Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Code:    ErrInternal,
+					Message: "Failed to fetch organisation",
+				})
+			}
+			if membership == nil {
+				return c.JSON(http.StatusNotFound, ErrorResponse{
+					Code:    ErrNotFound,
+					Message: "Organisation not found",
+				})
+			}
+			if !database.OrgRoleAtLeast(membership.Role, minRole) {
+				return c.JSON(http.StatusForbidden, ErrorResponse{
+					Code:    ErrForbidden,
+					Message: "You do not have permission to do this",
+				})
+			}
+
+			c.Set("membership", membership)
+			return next(c)
+		}
+	}
+}
+
+func membershipFromContext(c echo.Context) *database.Membership {
+	membership, _ := c.Get("membership").(*database.Membership)
+	return membership
+}
+
+// @Summary List organisations
+// @Description Lists the organisations the authenticated user belongs to, with their role in each.
+// @Tags organisations
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} database.Membership
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/organisations [get]
+func (app *application) handleGetOrganisations(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	memberships, err := app.models.Organisations.GetForUser(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch organisations",
+		})
+	}
+	return c.JSON(http.StatusOK, memberships)
+}
+
+// @Summary Create an organisation
+// @Description Creates an organisation with the authenticated user as its owner.
+// @Tags organisations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.OrganisationRequest true "Organisation"
+// @Success 201 {object} database.Membership
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/organisations [post]
+func (app *application) handleCreateOrganisation(c echo.Context) error {
+	var input OrganisationRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	org := database.Organisation{Name: input.Name}
+	if err := app.models.Organisations.Insert(&org, user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create organisation",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, database.Membership{Organisation: org, Role: database.OrgRoleOwner})
+}
+
+// @Summary Get an organisation
+// @Description Returns an organisation the authenticated user belongs to, with its members.
+// @Tags organisations
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Organisation ID"
+// @Success 200 {object} main.OrganisationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/organisations/{id} [get]
+func (app *application) handleGetOrganisation(c echo.Context) error {
+	membership := membershipFromContext(c)
+	members, err := app.models.Organisations.GetMembers(membership.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch members",
+		})
+	}
+	return c.JSON(http.StatusOK, OrganisationResponse{Membership: *membership, Members: members})
+}
+
+// @Summary Rename an organisation
+// @Description Renames an organisation. Owners and admins only.
+// @Tags organisations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Organisation ID"
+// @Param body body main.OrganisationRequest true "Organisation"
+// @Success 200 {object} database.Membership
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/organisations/{id} [patch]
+func (app *application) handleUpdateOrganisation(c echo.Context) error {
+	var input OrganisationRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	membership := membershipFromContext(c)
+	if err := app.models.Organisations.Rename(membership.Id, input.Name); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update organisation",
+		})
+	}
+
+	membership.Name = input.Name
+	return c.JSON(http.StatusOK, membership)
+}
+
+// @Summary Delete an organisation
+// @Description Deletes an organisation with all of its lists and todos. Owners only.
+// @Tags organisations
+// @Security BearerAuth
+// @Param id path string true "Organisation ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/organisations/{id} [delete]
+func (app *application) handleDeleteOrganisation(c echo.Context) error {
+	if err := app.models.Organisations.Delete(membershipFromContext(c).Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete organisation",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Change a member's role
+// @Description Changes the role of a member. Admins can manage members and guests; only owners can manage owners and admins.
+// @Tags organisations
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "Organisation ID"
+// @Param userId path string true "User ID"
+// @Param body body main.UpdateMemberRequest true "New role"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 409 {object} main.ErrorResponse "Would leave the organisation without an owner"
+// @Router /api/v1/organisations/{id}/members/{userId} [patch]
+func (app *application) handleUpdateMember(c echo.Context) error {
+	var input UpdateMemberRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	membership := membershipFromContext(c)
+	target, err := app.models.Organisations.GetMembership(membership.Id, c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to update member",
+		})
+	}
+	if target == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Member not found",
+		})
+	}
+
+	if !canManageMember(membership.Role, target.Role) || !canManageMember(membership.Role, input.Role) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrForbidden,
+			Message: "You do not have permission to do this",
+		})
+	}
+
+	if err := app.models.Organisations.UpdateMemberRole(membership.Id, c.Param("userId"), input.Role); err != nil {
+		return app.memberChangeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Remove a member
+// @Description Removes a member from an organisation. Any member can remove themselves.
+// @Tags organisations
+// @Security BearerAuth
+// @Param id path string true "Organisation ID"
+// @Param userId path string true "User ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 409 {object} main.ErrorResponse "Would leave the organisation without an owner"
+// @Router /api/v1/organisations/{id}/members/{userId} [delete]
+func (app *application) handleRemoveMember(c echo.Context) error {
+	membership := membershipFromContext(c)
+	userId := c.Param("userId")
+
+	if userId != app.GetUserFromContext(c).Id {
+		target, err := app.models.Organisations.GetMembership(membership.Id, userId)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    ErrInternal,
+				Message: "Failed to remove member",
+			})
+		}
+		if target == nil {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Member not found",
+			})
+		}
+		if !canManageMember(membership.Role, target.Role) {
+			return c.JSON(http.StatusForbidden, ErrorResponse{
+				Code:    ErrForbidden,
+				Message: "You do not have permission to do this",
+			})
+		}
+	}
+
+	if err := app.models.Organisations.RemoveMember(membership.Id, userId); err != nil {
+		return app.memberChangeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// canManageMember reports whether a member with role may change members
+// with, or grant, the other role.
+func canManageMember(role, other string) bool {
+	switch role {
+	case database.OrgRoleOwner:
+		return true
+	case database.OrgRoleAdmin:
+		return other == database.OrgRoleMember || other == database.OrgRoleGuest
+	}
+	return false
+}
+
+func (app *application) memberChangeError(c echo.Context, err error) error {
+	switch err.Error() {
+	case "member not found":
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Member not found",
+		})
+	case "last owner":
+		return c.JSON(http.StatusConflict, ErrorResponse{
+			Code:    ErrConflict,
+			Message: "An organisation must keep at least one owner",
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Code:    ErrInternal,
+		Message: "Failed to update member",
+	})
+}
+
+// @Summary List invitations
+// @Description Lists the pending invitations to an organisation. Owners and admins only.
+// @Tags organisations
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Organisation ID"
+// @Success 200 {array} database.Invitation
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/organisations/{id}/invitations [get]
+func (app *application) handleGetInvitations(c echo.Context) error {
+	invitations, err := app.models.Organisations.GetPendingInvitations(membershipFromContext(c).Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch invitations",
+		})
+	}
+	return c.JSON(http.StatusOK, invitations)
+}
+
+// @Summary Invite a member
+// @Description Emails an invitation to join an organisation. Owners and admins only; only owners can invite admins.
+// @Tags organisations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Organisation ID"
+// @Param body body main.InvitationRequest true "Invitation"
+// @Success 201 {object} database.Invitation
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/organisations/{id}/invitations [post]
+func (app *application) handleCreateInvitation(c echo.Context) error {
+	var input InvitationRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	membership := membershipFromContext(c)
+	if !canManageMember(membership.Role, input.Role) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrForbidden,
+			Message: "You do not have permission to do this",
+		})
+	}
+
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create invitation",
+		})
+	}
+
+	user := app.GetUserFromContext(c)
+	invitation := database.Invitation{
+		OrganisationId: membership.Id,
+		Email:          strings.ToLower(input.Email),
+		Role:           input.Role,
+		TokenHash:      utils.HashToken(token),
+		InvitedBy:      &user.Id,
+		ExpiresAt:      time.Now().Add(invitationTTL),
+	}
+	if err := app.models.Organisations.InsertInvitation(&invitation); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create invitation",
+		})
+	}
+
+	link := fmt.Sprintf("%s/invitations/accept?token=%s", app.appURL, url.QueryEscape(token))
+	orgName := membership.Name
+	app.background(func() {
+		app.sendInvitation(invitation.Email,
+			fmt.Sprintf("%s invited you to %s", user.Name, orgName),
+			fmt.Sprintf("%s has invited you to join %s as a %s.", user.Name, orgName, invitation.Role),
+			link)
+	})
+
+	return c.JSON(http.StatusCreated, invitation)
+}
+
+// @Summary Cancel an invitation
+// @Description Cancels a pending invitation. Owners and admins only.
+// @Tags organisations
+// @Security BearerAuth
+// @Param id path string true "Organisation ID"
+// @Param invitationId path string true "Invitation ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/organisations/{id}/invitations/{invitationId} [delete]
+func (app *application) handleDeleteInvitation(c echo.Context) error {
+	err := app.models.Organisations.DeleteInvitation(c.Param("invitationId"), membershipFromContext(c).Id)
+	if err != nil {
+		if err.Error() == "invitation not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Invitation not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to cancel invitation",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Accept an invitation
+// @Description Joins the organisation an invitation is for. The invitation must have been sent to the authenticated user's email address.
+// @Tags organisations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.AcceptInvitationRequest true "Invitation token"
+// @Success 200 {object} database.Membership
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Invitation is for another email address"
+// @Router /api/v1/invitations/accept [post]
+func (app *application) handleAcceptInvitation(c echo.Context) error {
+	var input AcceptInvitationRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	invitation, err := app.models.Organisations.GetPendingInvitationByHash(utils.HashToken(input.Token))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to accept invitation",
+		})
+	}
+	if invitation == nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Invitation is invalid or has expired",
+		})
+	}
+
+	user := app.GetUserFromContext(c)
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrForbidden,
+			Message: "This invitation was sent to a different email address",
+		})
+	}
+	// Otherwise anyone could sign up with the invited address and join
+	if user.EmailVerifiedAt == nil {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrEmailNotVerified,
+			Message: "Please verify your email address before accepting the invitation",
+		})
+	}
+
+	if err := app.models.Organisations.AcceptInvitation(invitation, user.Id); err != nil {
+		if err.Error() == "invitation not found" {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    ErrInvalidToken,
+				Message: "Invitation is invalid or has expired",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to accept invitation",
+		})
+	}
+
+	membership, err := app.models.Organisations.GetMembership(invitation.OrganisationId, user.Id)
+	if err != nil || membership == nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to accept invitation",
+		})
+	}
+	return c.JSON(http.StatusOK, membership)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/janst44/go-react-todo/internal/database"
+)
+
+// createTestOrganisation makes an organisation owned by owner and adds each
+// of members with the role it is mapped to.
+func createTestOrganisation(t *testing.T, app *application, owner *database.User, members map[*database.User]string) *database.Organisation {
+	t.Helper()
+
+	org := &database.Organisation{Name: "Acme"}
+	if err := app.models.Organisations.Insert(org, owner.Id); err != nil {
+		t.Fatalf("creating organisation: %v", err)
+	}
+	for user, role := range members {
+		_, err := app.models.Organisations.DB.Exec(
+			`INSERT INTO organisation_members (organisation_id, user_id, role) VALUES ($1, $2, $3)`,
+			org.Id, user.Id, role,
+		)
+		if err != nil {
+			t.Fatalf("adding %s: %v", role, err)
+		}
+	}
+	return org
+}
+
+func TestOrganisationRoleAccess(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+
+	owner := createTestUser(t, app, "owner@example.com", true)
+	users := map[string]*database.User{database.OrgRoleOwner: owner}
+	members := map[*database.User]string{}
+	for _, role := range []string{database.OrgRoleAdmin, database.OrgRoleMember, database.OrgRoleGuest} {
+		users[role] = createTestUser(t, app, role+"@example.com", true)
+		members[users[role]] = role
+	}
+	outsider := createTestUser(t, app, "outsider@example.com", true)
+
+	org := createTestOrganisation(t, app, owner, members)
+	list := &database.List{Name: "Roadmap", OrganisationId: &org.Id}
+	if err := app.models.Lists.Insert(list); err != nil {
+		t.Fatal(err)
+	}
+	todo, err := app.models.Todos.Insert(&database.TodoCreate{Title: "Ship it", ListId: &list.Id}, owner.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                string
+		user                *database.User
+		read, write, manage bool
+	}{
+		{"owner", users[database.OrgRoleOwner], true, true, true},
+		{"admin", users[database.OrgRoleAdmin], true, true, true},
+		{"member", users[database.OrgRoleMember], true, true, false},
+		{"guest", users[database.OrgRoleGuest], true, false, false},
+		{"outsider", outsider, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := app.models.Lists.Get(list.Id, tt.user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got != nil) != tt.read {
+				t.Errorf("read list = %v, want %v", got != nil, tt.read)
+			}
+
+			canWrite, err := app.models.Lists.CanWrite(list.Id, tt.user.Id)
+			if err != nil || canWrite != tt.write {
+				t.Errorf("write list = %v, %v; want %v", canWrite, err, tt.write)
+			}
+
+			canManage, err := app.models.Lists.CanManage(list.Id, tt.user.Id)
+			if err != nil || canManage != tt.manage {
+				t.Errorf("manage list = %v, %v; want %v", canManage, err, tt.manage)
+			}
+
+			gotTodo, err := app.models.Todos.GetOne(todo.Id, tt.user.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (gotTodo != nil) != tt.read {
+				t.Errorf("read todo = %v, want %v", gotTodo != nil, tt.read)
+			}
+
+			canWrite, err = app.models.Todos.CanWrite(todo.Id, tt.user.Id)
+			if err != nil || canWrite != tt.write {
+				t.Errorf("write todo = %v, %v; want %v", canWrite, err, tt.write)
+			}
+		})
+	}
+}
+
+func TestOrganisationKeepsAnOwner(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+
+	owner := createTestUser(t, app, "owner@example.com", true)
+	second := createTestUser(t, app, "second@example.com", true)
+	org := createTestOrganisation(t, app, owner, map[*database.User]string{second: database.OrgRoleOwner})
+
+	// Both owners step down at once; one of them has to stay
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, user := range []*database.User{owner, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i == 0 {
+				errs[i] = app.models.Organisations.UpdateMemberRole(org.Id, user.Id, database.OrgRoleMember)
+			} else {
+				errs[i] = app.models.Organisations.RemoveMember(org.Id, user.Id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			if err.Error() != "last owner" {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("errors = %v, want exactly one last owner error", errs)
+	}
+
+	members, err := app.models.Organisations.GetMembers(org.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := 0
+	for _, mb := range members {
+		if mb.Role == database.OrgRoleOwner {
+			owners++
+		}
+	}
+	if owners != 1 {
+		t.Errorf("owners = %d, want 1; members = %+v", owners, members)
+	}
+}
+
+func TestDeleteSoleOwner(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+
+	owner := createTestUser(t, app, "owner@example.com", true)
+	member := createTestUser(t, app, "member@example.com", true)
+	org := createTestOrganisation(t, app, owner, map[*database.User]string{member: database.OrgRoleMember})
+
+	if err := app.models.Users.Delete(owner.Id); !errors.Is(err, database.ErrSoleOwner) {
+		t.Fatalf("deleting the sole owner: err = %v, want %v", err, database.ErrSoleOwner)
+	}
+
+	// With a second owner the account can go
+	if err := app.models.Organisations.UpdateMemberRole(org.Id, member.Id, database.OrgRoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Users.Delete(owner.Id); err != nil {
+		t.Fatalf("deleting one of two owners: %v", err)
+	}
+	if got, _ := app.models.Users.Get(owner.Id); got != nil {
+		t.Errorf("user %s still exists", owner.Id)
+	}
+}
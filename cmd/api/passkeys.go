@@ -0,0 +1,434 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+const passkeyCeremonyTTL = 5 * time.Minute
+
+// PasskeyOptionsResponse carries the options for navigator.credentials.create()
+// or navigator.credentials.get(), plus the id that ties the browser's answer
+// back to this ceremony.
+type PasskeyOptionsResponse struct {
+	CeremonyId string      `json:"ceremonyId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Options    interface{} `json:"options" swaggertype:"object"`
+}
+
+// PasskeyRegisterRequest represents the result of navigator.credentials.create()
+type PasskeyRegisterRequest struct {
+	CeremonyId string          `json:"ceremonyId" validate:"required,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name       string          `json:"name" validate:"required,max=255" example:"MacBook Touch ID"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
+
+// PasskeyLoginRequest represents the result of navigator.credentials.get()
+type PasskeyLoginRequest struct {
+	CeremonyId string          `json:"ceremonyId" validate:"required,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
+
+// passkeyUser adapts a user and their stored passkeys to webauthn.User.
+type passkeyUser struct {
+	user     *database.User
+	passkeys []database.Passkey
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(u.user.Id)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.passkeys))
+	for _, p := range u.passkeys {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(p.Transports))
+		for _, t := range p.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              p.CredentialId,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    p.UserPresent,
+				UserVerified:   p.UserVerified,
+				BackupEligible: p.BackupEligible,
+				BackupState:    p.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    p.AAGUID,
+				SignCount: p.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+func (app *application) loadPasskeyUser(user *database.User) (*passkeyUser, error) {
+	passkeys, err := app.models.Passkeys.GetAllForUser(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyUser{user: user, passkeys: passkeys}, nil
+}
+
+// saveCeremony stores the WebAuthn session state and returns its id.
+func (app *application) saveCeremony(userId string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	return app.models.Passkeys.InsertSession(userId, data, time.Now().Add(passkeyCeremonyTTL))
+}
+
+// loadCeremony consumes a stored WebAuthn session. It returns nil if the
+// ceremony is unknown, expired or was already used.
+func (app *application) loadCeremony(id string, userId string) (*webauthn.SessionData, error) {
+	data, err := app.models.Passkeys.ConsumeSession(id, userId)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// @Summary Start passkey registration
+// @Description Returns the options to pass to navigator.credentials.create() to add a passkey to the authenticated account.
+// @Tags passkeys
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} main.PasskeyOptionsResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/auth/passkeys/register/begin [post]
+func (app *application) handleBeginPasskeyRegistration(c echo.Context) error {
+	pkUser, err := app.loadPasskeyUser(app.GetUserFromContext(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start passkey registration",
+		})
+	}
+
+	creation, session, err := app.webAuthn.BeginRegistration(pkUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(pkUser.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start passkey registration",
+		})
+	}
+
+	ceremonyId, err := app.saveCeremony(pkUser.user.Id, session)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start passkey registration",
+		})
+	}
+
+	return c.JSON(http.StatusOK, PasskeyOptionsResponse{CeremonyId: ceremonyId, Options: creation})
+}
+
+// @Summary Finish passkey registration
+// @Description Verifies the new credential created by the browser and stores it on the authenticated account.
+// @Tags passkeys
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.PasskeyRegisterRequest true "Attestation response"
+// @Success 201 {object} database.Passkey
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/auth/passkeys/register/finish [post]
+func (app *application) handleFinishPasskeyRegistration(c echo.Context) error {
+	var input PasskeyRegisterRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	session, err := app.loadCeremony(input.CeremonyId, user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to register passkey",
+		})
+	}
+	if session == nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Passkey registration has expired, please try again",
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrPasskeyRejected,
+			Message: "Invalid passkey response",
+			Details: err.Error(),
+		})
+	}
+
+	pkUser, err := app.loadPasskeyUser(user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to register passkey",
+		})
+	}
+
+	credential, err := app.webAuthn.CreateCredential(pkUser, *session, parsed)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrPasskeyRejected,
+			Message: "Passkey could not be verified",
+			Details: err.Error(),
+		})
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	passkey := database.Passkey{
+		UserId:          user.Id,
+		Name:            input.Name,
+		CredentialId:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		Transports:      transports,
+		SignCount:       credential.Authenticator.SignCount,
+		UserPresent:     credential.Flags.UserPresent,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := app.models.Passkeys.Insert(&passkey); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to register passkey",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, passkey)
+}
+
+// @Summary Start passkey login
+// @Description Returns the options to pass to navigator.credentials.get(). The browser lets the user pick any passkey registered for this site.
+// @Tags passkeys
+// @Produce json
+// @Success 200 {object} main.PasskeyOptionsResponse
+// @Router /api/v1/auth/passkeys/login/begin [post]
+func (app *application) handleBeginPasskeyLogin(c echo.Context) error {
+	assertion, session, err := app.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start passkey login",
+		})
+	}
+
+	ceremonyId, err := app.saveCeremony("", session)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to start passkey login",
+		})
+	}
+
+	return c.JSON(http.StatusOK, PasskeyOptionsResponse{CeremonyId: ceremonyId, Options: assertion})
+}
+
+// @Summary Finish passkey login
+// @Description Verifies the assertion signed by the user's passkey and returns the same JWT as the password login.
+// @Tags passkeys
+// @Accept json
+// @Produce json
+// @Param body body main.PasskeyLoginRequest true "Assertion response"
+// @Success 200 {object} main.LoginResponse
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 401 {object} main.ErrorResponse
+// @Failure 403 {object} main.ErrorResponse "Email not verified"
+// @Router /api/v1/auth/passkeys/login/finish [post]
+func (app *application) handleFinishPasskeyLogin(c echo.Context) error {
+	var input PasskeyLoginRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	session, err := app.loadCeremony(input.CeremonyId, "")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to log in",
+		})
+	}
+	if session == nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Passkey login has expired, please try again",
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrPasskeyRejected,
+			Message: "Invalid passkey response",
+			Details: err.Error(),
+		})
+	}
+
+	var pkUser *passkeyUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := app.models.Users.Get(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, protocol.ErrBadRequest.WithDetails("Unknown user")
+		}
+		pkUser, err = app.loadPasskeyUser(user)
+		return pkUser, err
+	}
+
+	_, credential, err := app.webAuthn.ValidatePasskeyLogin(findUser, *session, parsed)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrPasskeyRejected,
+			Message: "Passkey could not be verified",
+		})
+	}
+
+	// A counter that did not move forward suggests the authenticator has
+	// been cloned, so the credential is not trusted for this login.
+	if credential.Authenticator.CloneWarning {
+		log.Printf("passkey login: sign count did not increase for user %s", pkUser.user.Id)
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Code:    ErrPasskeyRejected,
+			Message: "Passkey could not be verified",
+		})
+	}
+
+	if err := app.models.Passkeys.UpdateAfterLogin(credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to log in",
+		})
+	}
+
+	if pkUser.user.DisabledAt != nil {
+		return app.accountDisabledResponse(c)
+	}
+
+	if app.requireEmailVerification && pkUser.user.EmailVerifiedAt == nil {
+		return c.JSON(http.StatusForbidden, ErrorResponse{
+			Code:    ErrEmailNotVerified,
+			Message: "Please verify your email address before logging in",
+		})
+	}
+
+	tokenString, err := app.generateToken(c, pkUser.user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Error generating token",
+		})
+	}
+
+	return app.loginResponse(c, tokenString)
+}
+
+// @Summary List passkeys
+// @Description Lists the passkeys registered to the authenticated user.
+// @Tags passkeys
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} database.Passkey
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Router /api/v1/auth/passkeys [get]
+func (app *application) handleGetPasskeys(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	passkeys, err := app.models.Passkeys.GetAllForUser(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch passkeys",
+		})
+	}
+	return c.JSON(http.StatusOK, passkeys)
+}
+
+// @Summary Delete a passkey
+// @Description Removes a passkey from the authenticated user's account.
+// @Tags passkeys
+// @Security BearerAuth
+// @Param id path string true "Passkey ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse "Not allowed with an API token"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/auth/passkeys/{id} [delete]
+func (app *application) handleDeletePasskey(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+
+	if err := app.models.Passkeys.Delete(c.Param("id"), user.Id); err != nil {
+		if err.Error() == "passkey not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Passkey not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete passkey",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// virtualAuthenticator is a software passkey. It answers the options the API
+// returns for navigator.credentials.create() and get() the way a browser and
+// a platform authenticator would, with "none" attestation.
+type virtualAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	userHandle   []byte
+	// signCount goes into the next response
+	signCount uint32
+}
+
+func clientDataJSON(t *testing.T, typ string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge.String(),
+		"origin":      testAppURL,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (a *virtualAuthenticator) authenticatorData(rpID string, attestedCredential []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified
+	if attestedCredential != nil {
+		flags |= protocol.FlagAttestedCredentialData
+	}
+
+	data := append(rpIDHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attestedCredential...)
+}
+
+// create makes a new credential for the user in options and returns the
+// PublicKeyCredential a browser would.
+func (a *virtualAuthenticator) create(t *testing.T, options protocol.CredentialCreation) json.RawMessage {
+	t.Helper()
+
+	userId, ok := options.Response.User.ID.(string)
+	if !ok {
+		t.Fatalf("user id = %v, want a base64url string", options.Response.User.ID)
+	}
+	var err error
+	if a.userHandle, err = base64.RawURLEncoding.DecodeString(userId); err != nil {
+		t.Fatal(err)
+	}
+	if a.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	a.credentialId = make([]byte, 16)
+	rand.Read(a.credentialId)
+
+	point, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An uncompressed point is 0x04 followed by both coordinates
+	xy := point.Bytes()[1:]
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: xy[:32],
+		YCoord: xy[32:],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The AAGUID of an authenticator without attestation is all zeros
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialId)))
+	attested = append(attested, a.credentialId...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(options.Response.RelyingParty.ID, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    clientDataJSON(t, "webauthn.create", options.Response.Challenge),
+		"attestationObject": attestationObject,
+		"transports":        []string{"internal"},
+	})
+}
+
+// get signs the challenge in options with the credential made by create.
+func (a *virtualAuthenticator) get(t *testing.T, options protocol.CredentialAssertion) json.RawMessage {
+	t.Helper()
+
+	clientData := clientDataJSON(t, "webauthn.get", options.Response.Challenge)
+	authData := a.authenticatorData(options.Response.RelyingPartyID, nil)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    clientData,
+		"authenticatorData": authData,
+		"signature":         signature,
+		"userHandle":        a.userHandle,
+	})
+}
+
+func (a *virtualAuthenticator) credential(t *testing.T, response map[string]interface{}) json.RawMessage {
+	t.Helper()
+
+	// Binary fields are base64url encoded, as in PublicKeyCredential.toJSON()
+	encoded := map[string]interface{}{}
+	for name, value := range response {
+		if b, ok := value.([]byte); ok {
+			value = base64.RawURLEncoding.EncodeToString(b)
+		}
+		encoded[name] = value
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(a.credentialId)
+	data, err := json.Marshal(map[string]interface{}{
+		"id":                      id,
+		"rawId":                   id,
+		"type":                    "public-key",
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]interface{}{},
+		"response":                encoded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// postJSON sends body to path, checks the response status and decodes the
+// response into out when it is not nil.
+func postJSON(t *testing.T, handler http.Handler, path, token string, body interface{}, wantStatus int, out interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		t.Fatalf("POST %s: status = %d, want %d; body = %s", path, rec.Code, wantStatus, rec.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+	}
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	handler := app.routes()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+	token := testToken(t, app, user.Id)
+
+	authenticator := &virtualAuthenticator{signCount: 1}
+
+	var creation struct {
+		CeremonyId string                      `json:"ceremonyId"`
+		Options    protocol.CredentialCreation `json:"options"`
+	}
+	postJSON(t, handler, "/api/v1/auth/passkeys/register/begin", token, nil, http.StatusOK, &creation)
+	if rk := creation.Options.Response.AuthenticatorSelection.ResidentKey; rk != protocol.ResidentKeyRequirementRequired {
+		t.Errorf("residentKey = %q, want a discoverable credential", rk)
+	}
+
+	postJSON(t, handler, "/api/v1/auth/passkeys/register/finish", token, PasskeyRegisterRequest{
+		CeremonyId: creation.CeremonyId,
+		Name:       "Virtual authenticator",
+		Credential: authenticator.create(t, creation.Options),
+	}, http.StatusCreated, nil)
+
+	stored := func(t *testing.T) database.Passkey {
+		t.Helper()
+		passkeys, err := app.models.Passkeys.GetAllForUser(user.Id)
+		if err != nil || len(passkeys) != 1 {
+			t.Fatalf("passkeys = %v, %v; want the one registered", passkeys, err)
+		}
+		return passkeys[0]
+	}
+	if passkey := stored(t); !bytes.Equal(passkey.CredentialId, authenticator.credentialId) || passkey.SignCount != 1 {
+		t.Fatalf("stored passkey %x with sign count %d, want %x with 1", passkey.CredentialId, passkey.SignCount, authenticator.credentialId)
+	}
+
+	// A ceremony can only be finished once
+	postJSON(t, handler, "/api/v1/auth/passkeys/register/finish", token, PasskeyRegisterRequest{
+		CeremonyId: creation.CeremonyId,
+		Name:       "Second authenticator",
+		Credential: (&virtualAuthenticator{signCount: 1}).create(t, creation.Options),
+	}, http.StatusBadRequest, nil)
+
+	login := func(t *testing.T, wantStatus int) {
+		t.Helper()
+
+		var assertion struct {
+			CeremonyId string                       `json:"ceremonyId"`
+			Options    protocol.CredentialAssertion `json:"options"`
+		}
+		postJSON(t, handler, "/api/v1/auth/passkeys/login/begin", "", nil, http.StatusOK, &assertion)
+
+		var res LoginResponse
+		postJSON(t, handler, "/api/v1/auth/passkeys/login/finish", "", PasskeyLoginRequest{
+			CeremonyId: assertion.CeremonyId,
+			Credential: authenticator.get(t, assertion.Options),
+		}, wantStatus, &res)
+		if wantStatus == http.StatusOK && res.Token == "" {
+			t.Fatal("login succeeded without a token")
+		}
+	}
+
+	authenticator.signCount = 2
+	login(t, http.StatusOK)
+	if got := stored(t).SignCount; got != 2 {
+		t.Fatalf("sign count = %d after login, want 2", got)
+	}
+
+	t.Run("sign count repeated", func(t *testing.T) {
+		authenticator.signCount = 2
+		login(t, http.StatusUnauthorized)
+	})
+
+	t.Run("sign count went back", func(t *testing.T) {
+		authenticator.signCount = 1
+		login(t, http.StatusUnauthorized)
+	})
+
+	// Rejected logins leave the stored counter alone
+	if got := stored(t).SignCount; got != 2 {
+		t.Fatalf("sign count = %d after rejected logins, want 2", got)
+	}
+	authenticator.signCount = 3
+	login(t, http.StatusOK)
+}
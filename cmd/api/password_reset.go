@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetTTL = time.Hour
+
+// ForgotPasswordRequest represents the forgot password payload
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email" example:"user@example.com"`
+}
+
+// ResetPasswordRequest represents the password reset payload
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required" example:"q3X9..."`
+	Password string `json:"password" validate:"required,min=8,max=72" example:"new-secret123"`
+}
+
+// @Summary Requests a password reset
+// @Description Emails a single-use reset link if the address belongs to an account. Always responds with 202 so the endpoint cannot be used to discover accounts.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body main.ForgotPasswordRequest true "Account email"
+// @Success 202 {string} string "Accepted"
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/auth/password/forgot [post]
+func (app *application) forgotPassword(c echo.Context) error {
+	if !app.passwordResetIPLimiter.Allow(c.RealIP()) {
+		return app.rateLimitedResponse(c)
+	}
+
+	var input ForgotPasswordRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	// Throttling per address is silent so it does not reveal which
+	// addresses have accounts.
+	email := strings.ToLower(input.Email)
+	if !app.passwordResetEmailLimiter.Allow(email) {
+		return c.NoContent(http.StatusAccepted)
+	}
+
+	// The lookup and email happen in the background so that response times
+	// are the same whether or not the account exists.
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			log.Printf("forgot password: %v", err)
+			return
+		}
+		if user == nil {
+			return
+		}
+
+		intro := "Someone asked to reset the password for your account. " +
+			"If it was you, open the link below to choose a new one:"
+		outro := "If you did not ask for this you can ignore this email."
+		if err := app.sendPasswordResetEmail(user, intro, outro); err != nil {
+			log.Printf("forgot password: %v", err)
+		}
+	})
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// sendPasswordResetEmail creates a reset token for user and emails the link.
+func (app *application) sendPasswordResetEmail(user *database.User, intro, outro string) error {
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+	if err := app.models.PasswordResets.Insert(user.Id, utils.HashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", app.appURL, url.QueryEscape(token))
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n%s\n\n%s\n\n"+
+			"The link expires in %d minutes and can only be used once. %s\n",
+			user.Name, intro, link, int(passwordResetTTL.Minutes()), outro),
+	})
+}
+
+// @Summary Resets a password
+// @Description Sets a new password using a token from the reset email, signs the user out everywhere and deletes their API tokens.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body main.ResetPasswordRequest true "Reset token and new password"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/auth/password/reset [post]
+func (app *application) resetPassword(c echo.Context) error {
+	if !app.passwordResetIPLimiter.Allow(c.RealIP()) {
+		return app.rateLimitedResponse(c)
+	}
+
+	var input ResetPasswordRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	userId, err := app.models.PasswordResets.Consume(utils.HashToken(input.Token))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+	if userId == "" {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Reset link is invalid or has expired",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+
+	if _, err := app.models.Users.UpdatePassword(userId, string(hashedPassword)); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to reset password",
+		})
+	}
+
+	if err := app.models.PasswordResets.DeleteAllForUser(userId); err != nil {
+		log.Printf("reset password: %v", err)
+	}
+	if err := app.revokeAllSessions(userId); err != nil {
+		log.Printf("reset password: %v", err)
+	}
+	if err := app.models.APITokens.DeleteAllForUser(userId); err != nil {
+		log.Printf("reset password: %v", err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// publicLinkPasswordHeader carries the password of a protected link, so
+	// it never ends up in URLs or access logs
+	publicLinkPasswordHeader = "X-Link-Password"
+	// publicListMaxAge bounds how long caches may serve a public list, and
+	// so how long a revoked link can keep working
+	publicListMaxAge = time.Minute
+)
+
+// PublicLinkRequest represents the create public link payload
+type PublicLinkRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2026-01-01T00:00:00Z"`
+	Password  *string    `json:"password,omitempty" validate:"omitempty,min=4,max=72" example:"hunter22"`
+}
+
+// PublicLinkResponse is a new public link. The token is only ever shown here.
+type PublicLinkResponse struct {
+	database.PublicLink
+	Token string `json:"token" example:"q3X9..."`
+	Path  string `json:"path" example:"/api/v1/public/lists/q3X9..."`
+}
+
+// PublicList is what anonymous visitors of a public link see
+type PublicList struct {
+	Name  string       `json:"name" example:"Groceries"`
+	Todos []PublicTodo `json:"todos"`
+}
+
+// PublicTodo is a todo without anything that identifies its author
+type PublicTodo struct {
+	Title       string    `json:"title" example:"Buy groceries"`
+	Description *string   `json:"description,omitempty" example:"Milk, eggs, and bread"`
+	Completed   bool      `json:"completed" example:"false"`
+	CreatedAt   time.Time `json:"createdAt" example:"2025-05-20T14:28:23Z"`
+}
+
+// @Summary List public links
+// @Description Lists the public links of a list that have not been revoked, with their view counts. Only users who can manage the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "List ID"
+// @Success 200 {array} database.PublicLink
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/links [get]
+func (app *application) handleGetPublicLinks(c echo.Context) error {
+	links, err := app.models.PublicLinks.GetForList(listFromContext(c).Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch links",
+		})
+	}
+	return c.JSON(http.StatusOK, links)
+}
+
+// @Summary Create a public link
+// @Description Publishes a list read-only to anyone with the returned link, optionally until a given time and behind a password. Only users who can manage the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "List ID"
+// @Param body body main.PublicLinkRequest true "Link options"
+// @Success 201 {object} main.PublicLinkResponse
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/links [post]
+func (app *application) handleCreatePublicLink(c echo.Context) error {
+	var input PublicLinkRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrValidationFailed,
+			Message: "Expiry must be in the future",
+		})
+	}
+
+	token, err := utils.NewOpaqueToken(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create link",
+		})
+	}
+
+	user := app.GetUserFromContext(c)
+	link := database.PublicLink{
+		ListId:    listFromContext(c).Id,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: input.ExpiresAt,
+		CreatedBy: &user.Id,
+	}
+	if input.Password != nil {
+		link.PasswordHash, err = bcrypt.GenerateFromPassword([]byte(*input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    ErrInternal,
+				Message: "Failed to create link",
+			})
+		}
+	}
+
+	if err := app.models.PublicLinks.Insert(&link); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to create link",
+		})
+	}
+
+	return c.JSON(http.StatusCreated, PublicLinkResponse{
+		PublicLink: link,
+		Token:      token,
+		Path:       "/api/v1/public/lists/" + token,
+	})
+}
+
+// @Summary Revoke a public link
+// @Description Stops a public link from working. Cached copies may be served for up to a minute. Only users who can manage the list.
+// @Tags sharing
+// @Security BearerAuth
+// @Param id path string true "List ID"
+// @Param linkId path string true "Link ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 403 {object} main.ErrorResponse
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/lists/{id}/links/{linkId} [delete]
+func (app *application) handleRevokePublicLink(c echo.Context) error {
+	if err := app.models.PublicLinks.Revoke(c.Param("linkId"), listFromContext(c).Id); err != nil {
+		if err.Error() == "link not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Link not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to revoke link",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary View a public list
+// @Description Returns a list published through a public link. Password-protected links need the password in the X-Link-Password header.
+// @Tags sharing
+// @Produce json
+// @Param token path string true "Link token"
+// @Param X-Link-Password header string false "Link password"
+// @Success 200 {object} main.PublicList
+// @Failure 401 {object} main.ErrorResponse "Password missing or wrong"
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/public/lists/{token} [get]
+func (app *application) handleGetPublicList(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("X-Robots-Tag", "noindex")
+	// Until we know the link is usable nothing may be cached, or a revoked
+	// or mistyped link could stick around
+	header.Set("Cache-Control", "no-store")
+
+	notFound := func() error {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Link not found or has expired",
+		})
+	}
+
+	link, err := app.models.PublicLinks.GetActiveByHash(utils.HashToken(c.Param("token")))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch list",
+		})
+	}
+	if link == nil {
+		return notFound()
+	}
+
+	if link.HasPassword {
+		if !app.publicLinkLimiter.Allow(c.RealIP()) {
+			return app.rateLimitedResponse(c)
+		}
+		password := c.Request().Header.Get(publicLinkPasswordHeader)
+		if password == "" || bcrypt.CompareHashAndPassword(link.PasswordHash, []byte(password)) != nil {
+			return c.JSON(http.StatusUnauthorized, ErrorResponse{
+				Code:    ErrUnauthorized,
+				Message: "This link needs a password",
+			})
+		}
+	}
+
+	list, err := app.models.Lists.GetById(link.ListId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch list",
+		})
+	}
+	if list == nil {
+		return notFound()
+	}
+
+	todos, err := app.models.Todos.GetForPublicList(list.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch list",
+		})
+	}
+
+	response := PublicList{Name: list.Name, Todos: make([]PublicTodo, 0, len(todos))}
+	for _, t := range todos {
+		response.Todos = append(response.Todos, PublicTodo{
+			Title:       t.Title,
+			Description: t.Description,
+			Completed:   t.Completed,
+			CreatedAt:   t.CreatedAt,
+		})
+	}
+
+	linkId := link.Id
+	app.background(func() {
+		if err := app.models.PublicLinks.RecordView(linkId); err != nil {
+			log.Printf("public link view: %v", err)
+		}
+	})
+
+	header.Set("Cache-Control", publicListCacheControl(link))
+	header.Set("Vary", publicLinkPasswordHeader)
+	return c.JSON(http.StatusOK, response)
+}
+
+// publicListCacheControl lets shared caches keep an open link for a short
+// while, never past its expiry. Password-protected lists are only cached
+// by the visitor's browser.
+func publicListCacheControl(link *database.PublicLink) string {
+	maxAge := publicListMaxAge
+	if link.ExpiresAt != nil {
+		if remaining := time.Until(*link.ExpiresAt); remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	if link.HasPassword {
+		return fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds()))
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// PushSubscriptionRequest is a browser push subscription, in the shape of
+// PushSubscription.toJSON()
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" validate:"required,url,startswith=https://,max=2048" example:"https://fcm.googleapis.com/fcm/send/abc123"`
+	Keys     struct {
+		P256dh string `json:"p256dh" validate:"required,max=200" example:"BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM"`
+		Auth   string `json:"auth" validate:"required,max=100" example:"tBHItJI5svbpez7KI4CCXg"`
+	} `json:"keys"`
+}
+
+// UnsubscribeRequest names the browser subscription to remove
+type UnsubscribeRequest struct {
+	Endpoint string `json:"endpoint" validate:"required" example:"https://fcm.googleapis.com/fcm/send/abc123"`
+}
+
+// PushKeyResponse is the key browsers subscribe to push notifications with
+type PushKeyResponse struct {
+	PublicKey string `json:"publicKey" example:"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"`
+}
+
+// @Summary Get the web push key
+// @Description Returns the VAPID public key to pass as applicationServerKey when subscribing a browser to push notifications.
+// @Tags push
+// @Produce json
+// @Success 200 {object} main.PushKeyResponse
+// @Failure 404 {object} main.ErrorResponse "Web push is not configured"
+// @Router /api/v1/push/key [get]
+func (app *application) handleGetPushKey(c echo.Context) error {
+	if app.vapid == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "Web push is not configured",
+		})
+	}
+	return c.JSON(http.StatusOK, PushKeyResponse{PublicKey: app.vapid.PublicKey})
+}
+
+// @Summary Subscribe to push notifications
+// @Description Registers a browser to receive the authenticated user's notifications as web push messages. The endpoint must belong to a known push service.
+// @Tags push
+// @Security BearerAuth
+// @Accept json
+// @Param body body main.PushSubscriptionRequest true "Subscription"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/push/subscriptions [post]
+func (app *application) handleCreatePushSubscription(c echo.Context) error {
+	var input PushSubscriptionRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	if !app.knownPushService(input.Endpoint) {
+		return c.JSON(http.StatusBadRequest, ValidationResponse{
+			Code:    ErrValidationFailed,
+			Message: "Validation failed",
+			Errors:  []ValidationError{{Field: "endpoint", Message: "must belong to a known push service"}},
+		})
+	}
+
+	user := app.GetUserFromContext(c)
+	err := app.models.PushSubscriptions.Upsert(&database.PushSubscription{
+		UserId:   user.Id,
+		Endpoint: input.Endpoint,
+		P256dh:   input.Keys.P256dh,
+		Auth:     input.Keys.Auth,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to save subscription",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Unsubscribe from push notifications
+// @Description Stops sending the authenticated user's notifications to a browser.
+// @Tags push
+// @Security BearerAuth
+// @Accept json
+// @Param body body main.UnsubscribeRequest true "Subscription"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/push/subscriptions [delete]
+func (app *application) handleDeletePushSubscription(c echo.Context) error {
+	var input UnsubscribeRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	if err := app.models.PushSubscriptions.Delete(input.Endpoint, user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to remove subscription",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// knownPushService reports whether endpoint is on one of the push services
+// browsers may subscribe with. The scheduler posts to endpoints from inside
+// the network, so they must not point anywhere else.
+func (app *application) knownPushService(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Port() != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range app.pushServiceHosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && (host == h || strings.HasSuffix(host, "."+h)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/quickadd"
+	"github.com/labstack/echo/v4"
+)
+
+// QuickAddRequest represents the quick add payload
+type QuickAddRequest struct {
+	Text string `json:"text" validate:"required,max=1000" example:"Pay rent every 1st of month at 9am #finance !high"`
+}
+
+// ParsedTodo is what was read from quick add text. ListId is the list the
+// text referred to, if the user has a list by that name.
+type ParsedTodo struct {
+	quickadd.Result
+	ListId *string `json:"listId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// QuickAddResponse is the todo created from quick add text
+type QuickAddResponse struct {
+	Parsed ParsedTodo    `json:"parsed"`
+	Todo   database.Todo `json:"todo"`
+}
+
+// @Summary Quick add a todo
+// @Description Creates a todo from a line of text such as "Pay rent every 1st of month at 9am #finance !high". Dates and times are read in the user's time zone. The text can contain #tags, a !priority (low, medium, high or urgent), a ~list or ~"list name", a due date and time such as tomorrow at 5pm, next friday, in 3 days or may 5, and a recurrence such as every weekday or every 1st of the month.
+// @Tags todos
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.QuickAddRequest true "Text"
+// @Success 201 {object} main.QuickAddResponse
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse "List not found"
+// @Router /api/v1/todos/quick [post]
+func (app *application) handleQuickAddTodo(c echo.Context) error {
+	parsed, err := app.parseQuickAdd(c)
+	if err != nil || parsed == nil {
+		return err
+	}
+
+	if parsed.List != "" && parsed.ListId == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "List not found",
+		})
+	}
+
+	input := database.TodoCreate{
+		Title:  parsed.Title,
+		ListId: parsed.ListId,
+		DueAt:  parsed.DueAt,
+		AllDay: parsed.AllDay,
+		Tags:   parsed.Tags,
+	}
+	if parsed.Recurrence != "" {
+		input.Recurrence = &parsed.Recurrence
+	}
+	if parsed.Priority != "" {
+		input.Priority = &parsed.Priority
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	todo, err := app.models.Todos.Insert(&input, user.Id)
+	if err != nil {
+		return createTodoErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, QuickAddResponse{Parsed: *parsed, Todo: *todo})
+}
+
+// @Summary Parse quick add text
+// @Description Shows what quick add would read from a line of text without creating a todo, for previewing it as the user types.
+// @Tags todos
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body main.QuickAddRequest true "Text"
+// @Success 200 {object} main.ParsedTodo
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/todos/quick/parse [post]
+func (app *application) handleParseQuickAdd(c echo.Context) error {
+	parsed, err := app.parseQuickAdd(c)
+	if err != nil || parsed == nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, parsed)
+}
+
+// parseQuickAdd reads the quick add text from the request. It returns nil
+// once it has written an error response.
+func (app *application) parseQuickAdd(c echo.Context) (*ParsedTodo, error) {
+	var input QuickAddRequest
+	if err := c.Bind(&input); err != nil {
+		return nil, c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return nil, app.failedValidationResponse(c, err)
+	}
+
+	user := app.GetUserFromContext(c)
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	parsed := &ParsedTodo{Result: quickadd.Parse(input.Text, time.Now().In(loc))}
+	if parsed.List != "" {
+		lists, err := app.models.Lists.GetAllForUser(user.Id)
+		if err != nil {
+			return nil, c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    ErrInternal,
+				Message: "Failed to fetch lists",
+			})
+		}
+		for _, l := range lists {
+			if strings.EqualFold(l.Name, parsed.List) {
+				parsed.ListId = &l.Id
+				break
+			}
+		}
+	}
+	return parsed, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/notify"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// reminderBatch is how many due reminders are claimed at a time
+	reminderBatch = 50
+	// reminderLease is how long a claimed reminder is left to be delivered
+	// before another poll may claim it again
+	reminderLease = 5 * time.Minute
+)
+
+// ReminderRequest represents the create reminder payload. Set either
+// remindAt or offsetMinutes.
+type ReminderRequest struct {
+	RemindAt      *time.Time `json:"remindAt,omitempty" validate:"required_without=OffsetMinutes,excluded_with=OffsetMinutes" example:"2025-06-01T08:30:00Z"`
+	OffsetMinutes *int       `json:"offsetMinutes,omitempty" validate:"required_without=RemindAt,omitempty,min=0,max=525600" example:"30"`
+}
+
+// @Summary List reminders
+// @Description Lists the authenticated user's reminders on a todo.
+// @Tags reminders
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Success 200 {array} database.Reminder
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/reminders [get]
+func (app *application) handleGetReminders(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	reminders, err := app.models.Reminders.GetForTodo(todoFromContext(c).Id, user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch reminders",
+		})
+	}
+	return c.JSON(http.StatusOK, reminders)
+}
+
+// @Summary Add a reminder
+// @Description Reminds the authenticated user of a todo they can read, at a set time or a number of minutes before the todo is due. Only todos with a due date take offset reminders; if the due date is cleared later they wait until it is set again. Reminders arrive in the in-app inbox, by email and as push notifications in browsers the user subscribed.
+// @Tags reminders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param body body main.ReminderRequest true "Reminder"
+// @Success 201 {object} database.Reminder
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Failure 422 {object} main.ErrorResponse "offsetMinutes was set but the todo has no due date"
+// @Router /api/v1/todos/{id}/reminders [post]
+func (app *application) handleCreateReminder(c echo.Context) error {
+	var input ReminderRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	todo := todoFromContext(c)
+	if input.OffsetMinutes != nil && todo.DueAt == nil {
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Code:    ErrValidationFailed,
+			Message: "The todo has no due date to remind you before",
+		})
+	}
+
+	user := app.GetUserFromContext(c)
+	reminder := database.Reminder{
+		TodoId:        todo.Id,
+		UserId:        user.Id,
+		RemindAt:      input.RemindAt,
+		OffsetMinutes: input.OffsetMinutes,
+	}
+	if err := app.models.Reminders.Insert(&reminder); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to add reminder",
+		})
+	}
+	return c.JSON(http.StatusCreated, reminder)
+}
+
+// @Summary Delete a reminder
+// @Description Deletes one of the authenticated user's reminders.
+// @Tags reminders
+// @Security BearerAuth
+// @Param id path string true "Todo ID"
+// @Param reminderId path string true "Reminder ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/reminders/{reminderId} [delete]
+func (app *application) handleDeleteReminder(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	if err := app.models.Reminders.Delete(c.Param("reminderId"), todoFromContext(c).Id, user.Id); err != nil {
+		if err.Error() == "reminder not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Reminder not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to delete reminder",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// sendReminders delivers the reminders that have gone off. Reminders on
+// completed todos, or that the user can no longer see, are dropped.
+func (app *application) sendReminders() {
+	for {
+		due, err := app.models.Reminders.ClaimDue(reminderBatch, reminderLease)
+		if err != nil {
+			log.Printf("reminders: %v", err)
+			return
+		}
+
+		for _, r := range due {
+			if r.Deliverable && !r.Completed {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				if err := app.notifier.Notify(ctx, reminderNotification(&r, app.appURL)); err != nil {
+					log.Printf("reminder %s: %v", r.Id, err)
+				}
+				cancel()
+			}
+			if err := app.models.Reminders.MarkSent(r.Id); err != nil {
+				log.Printf("reminders: %v", err)
+			}
+		}
+
+		if len(due) < reminderBatch {
+			return
+		}
+	}
+}
+
+func reminderNotification(r *database.DueReminder, appURL string) *notify.Notification {
+	body := fmt.Sprintf("This is your reminder about \"%s\".", r.TodoTitle)
+	if r.DueAt != nil {
+		loc, err := time.LoadLocation(r.UserTimeZone)
+		if err != nil {
+			loc = time.UTC
+		}
+		body = fmt.Sprintf("\"%s\" is due %s.", r.TodoTitle, r.DueAt.In(loc).Format("Mon, 2 Jan 15:04 MST"))
+	}
+
+	todoId := r.TodoId
+	return &notify.Notification{
+		UserId: r.UserId,
+		Name:   r.UserName,
+		Email:  r.UserEmail,
+		Type:   notify.TypeReminder,
+		Title:  "Reminder: " + r.TodoTitle,
+		Body:   body,
+		TodoId: &todoId,
+		URL:    appURL,
+	}
+}
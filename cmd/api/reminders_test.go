@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+)
+
+func TestCreateReminderNeedsDueDateForOffset(t *testing.T) {
+	app := newTestApp(t)
+	useTestDB(t, app)
+	handler := app.routes()
+
+	user := createTestUser(t, app, "ada@example.com", true)
+	token := testToken(t, app, user.Id)
+
+	dueAt := time.Now().Add(24 * time.Hour)
+	undated, err := app.models.Todos.Insert(&database.TodoCreate{Title: "Someday"}, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dated, err := app.models.Todos.Insert(&database.TodoCreate{Title: "Tomorrow", DueAt: &dueAt}, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset := 30
+	remindAt := time.Now().Add(time.Hour)
+
+	postJSON(t, handler, "/api/v1/todos/"+undated.Id+"/reminders", token,
+		ReminderRequest{OffsetMinutes: &offset}, http.StatusUnprocessableEntity, nil)
+	postJSON(t, handler, "/api/v1/todos/"+undated.Id+"/reminders", token,
+		ReminderRequest{RemindAt: &remindAt}, http.StatusCreated, nil)
+
+	var reminder database.Reminder
+	postJSON(t, handler, "/api/v1/todos/"+dated.Id+"/reminders", token,
+		ReminderRequest{OffsetMinutes: &offset}, http.StatusCreated, &reminder)
+	if want := dueAt.Add(-30 * time.Minute); reminder.FireAt == nil || !reminder.FireAt.Equal(want.Truncate(time.Microsecond)) {
+		t.Errorf("fireAt = %v, want %v", reminder.FireAt, want)
+	}
+}
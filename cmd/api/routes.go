@@ -2,9 +2,10 @@ package main
 
 import (
 	"net/http"
+	"strconv"
 
 	_ "github.com/janst44/go-react-todo/docs"
-	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/janst44/go-react-todo/internal/database"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
@@ -12,25 +13,154 @@ import (
 
 func (app *application) routes() http.Handler {
 	e := echo.New()
-	e.Validator = utils.NewValidator()
+	e.Validator = app.validator
+	e.IPExtractor = app.ipExtractor()
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"http://localhost:3000"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowOrigins: app.corsOrigins,
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", csrfHeader, publicLinkPasswordHeader},
+		// Credentials let the browser send the session cookie cross-origin,
+		// which is only safe because the origins are listed explicitly
+		AllowCredentials: true,
 	}))
 	v1 := e.Group("/api/v1")
 	{
 		v1.POST("/auth/register", app.registerUser)
 		v1.POST("/auth/login", app.login)
+		v1.POST("/auth/login/mfa", app.loginMFA)
+		v1.GET("/auth/csrf", app.handleGetCSRFToken)
+		v1.POST("/auth/verify", app.verifyEmail)
+		v1.POST("/auth/verify/resend", app.resendVerificationEmail)
+		v1.POST("/auth/password/forgot", app.forgotPassword)
+		v1.POST("/auth/password/reset", app.resetPassword)
+		v1.POST("/auth/passkeys/login/begin", app.handleBeginPasskeyLogin)
+		v1.POST("/auth/passkeys/login/finish", app.handleFinishPasskeyLogin)
+		v1.GET("/auth/oidc/providers", app.handleGetOIDCProviders)
+		v1.GET("/auth/oidc/:provider/login", app.handleOIDCLogin)
+		v1.GET("/auth/oidc/:provider/callback", app.handleOIDCCallback)
+		v1.GET("/public/lists/:token", app.handleGetPublicList)
+		v1.GET("/push/key", app.handleGetPushKey)
 	}
 
 	authGroup := v1.Group("")
 	authGroup.Use(app.AuthMiddleware())
+
+	// API tokens only reach the routes their scopes allow
+	todosRead := app.RequireScope(ScopeTodosRead)
+	todosWrite := app.RequireScope(ScopeTodosWrite)
+	account := app.RequireScope(ScopeAccount)
+	sessionOnly := app.RequireSession()
+	listManager := app.RequireListManager()
+	todoReader := app.RequireTodo()
+	todoWriter := app.RequireTodoWriter()
 	{
-		authGroup.GET("/todos", app.handleGetTodos)
-		authGroup.POST("/todos", app.handleCreateTodo)
-		authGroup.PATCH("/todos/:id", app.handleUpdateTodo)
-		authGroup.DELETE("/todos/:id", app.handleDeleteTodo)
+		authGroup.POST("/auth/logout", app.handleLogout)
+
+		authGroup.GET("/todos", app.handleGetTodos, todosRead)
+		authGroup.POST("/todos", app.handleCreateTodo, todosWrite)
+		authGroup.POST("/todos/quick", app.handleQuickAddTodo, todosWrite)
+		authGroup.POST("/todos/quick/parse", app.handleParseQuickAdd, todosRead)
+		authGroup.PATCH("/todos/:id", app.handleUpdateTodo, todosWrite)
+		authGroup.DELETE("/todos/:id", app.handleDeleteTodo, todosWrite)
+		authGroup.GET("/todos/:id/history", app.handleGetTodoHistory, todosRead, todoReader)
+		authGroup.POST("/todos/:id/history/:eventId/revert", app.handleRevertTodo, todosWrite, todoReader, todoWriter)
+		authGroup.GET("/todos/:id/reminders", app.handleGetReminders, todosRead, todoReader)
+		authGroup.POST("/todos/:id/reminders", app.handleCreateReminder, todosWrite, todoReader)
+		authGroup.DELETE("/todos/:id/reminders/:reminderId", app.handleDeleteReminder, todosWrite, todoReader)
+		authGroup.GET("/todos/:id/watchers", app.handleGetWatchers, todosRead, todoReader)
+		authGroup.POST("/todos/:id/watch", app.handleWatchTodo, todosWrite, todoReader)
+		authGroup.DELETE("/todos/:id/watch", app.handleUnwatchTodo, todosWrite)
+		authGroup.GET("/todos/:id/comments", app.handleGetComments, todosRead, todoReader)
+		authGroup.POST("/todos/:id/comments", app.handleCreateComment, todosWrite, todoReader)
+		authGroup.PATCH("/todos/:id/comments/:commentId", app.handleUpdateComment, todosWrite, todoReader)
+		authGroup.DELETE("/todos/:id/comments/:commentId", app.handleDeleteComment, todosWrite, todoReader)
+		authGroup.GET("/todos/:id/attachments", app.handleGetAttachments, todosRead, todoReader)
+		// The body limit leaves room for the multipart envelope around the file
+		authGroup.POST("/todos/:id/attachments", app.handleUploadAttachment, todosWrite, todoReader, todoWriter,
+			middleware.BodyLimit(strconv.FormatInt(app.attachmentMaxBytes+1<<20, 10)))
+		authGroup.GET("/todos/:id/attachments/:attachmentId", app.handleDownloadAttachment, todosRead, todoReader)
+		authGroup.DELETE("/todos/:id/attachments/:attachmentId", app.handleDeleteAttachment, todosWrite, todoReader, todoWriter)
+
+		authGroup.POST("/undo", app.handleUndo, todosWrite)
+		authGroup.POST("/redo", app.handleRedo, todosWrite)
+
+		authGroup.GET("/lists", app.handleGetLists, todosRead)
+		authGroup.POST("/lists", app.handleCreateList, todosWrite)
+		authGroup.GET("/lists/:id", app.handleGetList, todosRead)
+		authGroup.PATCH("/lists/:id", app.handleUpdateList, todosWrite)
+		authGroup.DELETE("/lists/:id", app.handleDeleteList, todosWrite)
+		authGroup.GET("/lists/:id/shares", app.handleGetListShares, todosRead, listManager)
+		authGroup.POST("/lists/:id/shares", app.handleShareList, todosWrite, listManager)
+		authGroup.PATCH("/lists/:id/shares/:userId", app.handleUpdateListShare, todosWrite, listManager)
+		authGroup.DELETE("/lists/:id/shares/:userId", app.handleDeleteListShare, todosWrite)
+		authGroup.DELETE("/lists/:id/shares/invitations/:invitationId", app.handleDeleteShareInvitation, todosWrite, listManager)
+		authGroup.GET("/lists/:id/links", app.handleGetPublicLinks, todosRead, listManager)
+		authGroup.POST("/lists/:id/links", app.handleCreatePublicLink, todosWrite, listManager)
+		authGroup.DELETE("/lists/:id/links/:linkId", app.handleRevokePublicLink, todosWrite, listManager)
+		authGroup.GET("/shared", app.handleGetSharedLists, todosRead)
+		authGroup.POST("/shares/accept", app.handleAcceptShareInvitation, account)
+
+		authGroup.GET("/organisations", app.handleGetOrganisations, account)
+		authGroup.POST("/organisations", app.handleCreateOrganisation, account)
+		authGroup.POST("/invitations/accept", app.handleAcceptInvitation, account)
+
+		authGroup.GET("/me", app.handleGetMe, account)
+		authGroup.PATCH("/me", app.handleUpdateMe, account)
+		authGroup.DELETE("/me", app.handleDeleteMe, account)
+		authGroup.POST("/me/password", app.handleChangePassword, account, sessionOnly)
+		authGroup.POST("/me/email", app.handleChangeEmail, account, sessionOnly)
+		authGroup.POST("/me/mfa/totp", app.handleEnrollTOTP, account, sessionOnly)
+		authGroup.POST("/me/mfa/totp/confirm", app.handleConfirmTOTP, account, sessionOnly)
+		authGroup.POST("/me/mfa/totp/disable", app.handleDisableTOTP, account, sessionOnly)
+		authGroup.POST("/me/mfa/recovery-codes", app.handleRegenerateRecoveryCodes, account, sessionOnly)
+		authGroup.GET("/me/tokens", app.handleGetAPITokens, account, sessionOnly)
+		authGroup.POST("/me/tokens", app.handleCreateAPIToken, account, sessionOnly)
+		authGroup.DELETE("/me/tokens/:id", app.handleDeleteAPIToken, account, sessionOnly)
+		authGroup.GET("/me/sessions", app.handleGetSessions, account)
+		authGroup.DELETE("/me/sessions", app.handleDeleteSessions, account)
+		authGroup.DELETE("/me/sessions/:id", app.handleDeleteSession, account)
+		authGroup.POST("/push/subscriptions", app.handleCreatePushSubscription, account)
+		authGroup.DELETE("/push/subscriptions", app.handleDeletePushSubscription, account)
+		authGroup.GET("/me/notification-preferences", app.handleGetNotificationPreferences, account)
+		authGroup.PATCH("/me/notification-preferences", app.handleUpdateNotificationPreferences, account)
+		authGroup.GET("/notifications", app.handleGetNotifications, account)
+		authGroup.GET("/notifications/stream", app.handleNotificationStream, account)
+		authGroup.POST("/notifications/read-all", app.handleMarkAllNotificationsRead, account)
+		authGroup.POST("/notifications/:id/read", app.handleMarkNotificationRead, account)
+
+		authGroup.GET("/auth/passkeys", app.handleGetPasskeys, account, sessionOnly)
+		authGroup.DELETE("/auth/passkeys/:id", app.handleDeletePasskey, account, sessionOnly)
+		authGroup.POST("/auth/passkeys/register/begin", app.handleBeginPasskeyRegistration, account, sessionOnly)
+		authGroup.POST("/auth/passkeys/register/finish", app.handleFinishPasskeyRegistration, account, sessionOnly)
 	}
+
+	// Organisation routes load the caller's membership of :id
+	org := authGroup.Group("/organisations/:id", account)
+	{
+		guest := app.RequireOrgRole(database.OrgRoleGuest)
+		orgAdmin := app.RequireOrgRole(database.OrgRoleAdmin)
+		owner := app.RequireOrgRole(database.OrgRoleOwner)
+
+		org.GET("", app.handleGetOrganisation, guest)
+		org.PATCH("", app.handleUpdateOrganisation, orgAdmin)
+		org.DELETE("", app.handleDeleteOrganisation, owner)
+		org.PATCH("/members/:userId", app.handleUpdateMember, orgAdmin)
+		org.DELETE("/members/:userId", app.handleRemoveMember, guest)
+		org.GET("/invitations", app.handleGetInvitations, orgAdmin)
+		org.POST("/invitations", app.handleCreateInvitation, orgAdmin)
+		org.DELETE("/invitations/:invitationId", app.handleDeleteInvitation, orgAdmin)
+	}
+
+	admin := authGroup.Group("/admin", app.RequireScope(ScopeAdmin), app.RequireRole(database.RoleAdmin))
+	{
+		admin.GET("/users", app.handleAdminListUsers)
+		admin.GET("/users/:id", app.handleAdminGetUser)
+		admin.POST("/users/:id/disable", app.handleAdminDisableUser)
+		admin.POST("/users/:id/enable", app.handleAdminEnableUser)
+		admin.POST("/users/:id/password-reset", app.handleAdminForcePasswordReset)
+		admin.GET("/audit-log", app.handleAdminGetAuditLog)
+	}
+
+	e.GET("/.well-known/jwks.json", app.handleJWKS)
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	return e
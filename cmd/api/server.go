@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/labstack/echo/v4"
 )
 
 func (app *application) serve() error {
@@ -15,6 +19,67 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	app.background(func() {
+		for range time.Tick(app.attachmentSweepInterval) {
+			app.sweepAttachments()
+		}
+	})
+	app.background(func() {
+		for range time.Tick(app.reminderPollInterval) {
+			app.sendReminders()
+		}
+	})
+	app.background(app.relayNotifications)
+
 	log.Printf("Starting server on %s", server.Addr)
 	return server.ListenAndServe()
 }
+
+// ipExtractor decides which address c.RealIP() reports. Without trusted
+// proxies it is the address the connection came from. Otherwise
+// X-Forwarded-For is followed back through the trusted proxies only, so
+// clients cannot pick the address rate limits and audit entries see.
+func (app *application) ipExtractor() echo.IPExtractor {
+	if len(app.trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxies := range app.trustedProxies {
+		options = append(options, echo.TrustIPRange(proxies))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// parseTrustedProxies reads a comma separated list of proxy addresses and
+// CIDR ranges.
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPExtractor(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		proxies    bool
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", false, "203.0.113.7:4000", "", "203.0.113.7"},
+		{"forged header without proxies", false, "203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"forged header from a private address", false, "192.168.1.5:4000", "198.51.100.1", "192.168.1.5"},
+		{"trusted proxy", true, "10.1.2.3:4000", "198.51.100.1", "198.51.100.1"},
+		{"trusted single address", true, "[2001:db8::1]:4000", "198.51.100.1", "198.51.100.1"},
+		{"client prepends a forged hop", true, "10.1.2.3:4000", "192.0.2.66, 198.51.100.1", "198.51.100.1"},
+		{"untrusted peer", true, "203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"private peer not listed", true, "192.168.1.5:4000", "198.51.100.1", "192.168.1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			if tt.proxies {
+				app.trustedProxies = proxies
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			req.Header.Set("X-Real-IP", "192.0.2.99")
+
+			if got := app.ipExtractor()(req); got != tt.want {
+				t.Errorf("client address = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0"} {
+		if _, err := parseTrustedProxies(value); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded, want an error", value)
+		}
+	}
+	if proxies, err := parseTrustedProxies(""); err != nil || len(proxies) != 0 {
+		t.Errorf("parseTrustedProxies(\"\") = %v, %v; want none", proxies, err)
+	}
+}
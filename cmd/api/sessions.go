@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// SessionResponse is an active login of the authenticated user.
+type SessionResponse struct {
+	database.Session
+	Current bool `json:"current" example:"true"`
+}
+
+// sessionActive reports whether the session behind a JWT can still be used.
+// Answers are cached briefly so most requests skip the database.
+func (app *application) sessionActive(id string) (bool, error) {
+	if active, ok := app.sessionCache.Get(id); ok {
+		return active, nil
+	}
+
+	session, err := app.models.Sessions.GetActive(id)
+	if err != nil {
+		return false, err
+	}
+
+	active := session != nil
+	app.sessionCache.Set(id, active)
+
+	if active {
+		app.background(func() {
+			if err := app.models.Sessions.Touch(id); err != nil {
+				log.Printf("session last seen: %v", err)
+			}
+		})
+	}
+	return active, nil
+}
+
+// revokeAllSessions signs the user out everywhere.
+func (app *application) revokeAllSessions(userId string) error {
+	ids, err := app.models.Sessions.RevokeAllForUser(userId)
+	if err != nil {
+		return err
+	}
+	app.sessionCache.Revoke(ids...)
+	return nil
+}
+
+// currentSessionId returns the session the request was authenticated with,
+// or "" for API tokens.
+func currentSessionId(c echo.Context) string {
+	claims, ok := c.Get("claims").(*Claims)
+	if !ok {
+		return ""
+	}
+	return claims.ID
+}
+
+// describeDevice turns a user agent into a short label such as
+// "Firefox on Windows" for the sessions list.
+func describeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser := ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+// @Summary List sessions
+// @Description Lists the devices the authenticated user is signed in on.
+// @Tags account
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} main.SessionResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/me/sessions [get]
+func (app *application) handleGetSessions(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	sessions, err := app.models.Sessions.GetActiveForUser(user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch sessions",
+		})
+	}
+
+	current := currentSessionId(c)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, SessionResponse{Session: s, Current: s.Id == current})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// @Summary Revoke a session
+// @Description Signs the authenticated user out of one device.
+// @Tags account
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/me/sessions/{id} [delete]
+func (app *application) handleDeleteSession(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	id := c.Param("id")
+
+	if err := app.models.Sessions.Revoke(id, user.Id); err != nil {
+		if err.Error() == "session not found" {
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "Session not found",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to revoke session",
+		})
+	}
+	app.sessionCache.Revoke(id)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Sign out everywhere
+// @Description Revokes every session of the authenticated user, including the current one.
+// @Tags account
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/me/sessions [delete]
+func (app *application) handleDeleteSessions(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+
+	if err := app.revokeAllSessions(user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to revoke sessions",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -3,22 +3,46 @@ package main
 import (
 	"net/http"
 
+	"github.com/google/uuid"
 	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/notify"
 	"github.com/labstack/echo/v4"
 )
 
 // @Summary Get all todos
-// @Description Retrieves a list of all todos for the authenticated user.
+// @Description Retrieves the personal todos of the authenticated user, or the todos in a list they can read. Filtering by assignee without a list searches every todo they can read.
 // @Tags todos
 // @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param listId query string false "List ID"
+// @Param assignee query string false "Assignee user ID, or me"
 // @Success 200 {array} database.Todo
+// @Failure 400 {object} main.ErrorResponse
 // @Failure 401 {string} string "Unauthorized"
 // @Router /api/v1/todos [get]
 func (app *application) handleGetTodos(c echo.Context) error {
 	user := app.GetUserFromContext(c)
-	todos, err := app.models.Todos.Get(user.Id)
+
+	var filter database.TodoFilter
+	if id := c.QueryParam("listId"); id != "" {
+		filter.ListId = &id
+	}
+	switch assignee := c.QueryParam("assignee"); assignee {
+	case "":
+	case "me":
+		filter.AssigneeId = &user.Id
+	default:
+		if _, err := uuid.Parse(assignee); err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    ErrValidationFailed,
+				Message: "assignee must be a user ID or me",
+			})
+		}
+		filter.AssigneeId = &assignee
+	}
+
+	todos, err := app.models.Todos.Get(user.Id, filter)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Code:    "INTERNAL_ERROR",
@@ -29,15 +53,16 @@ func (app *application) handleGetTodos(c echo.Context) error {
 }
 
 // @Summary Create a new todo
-// @Description Adds a new todo for the authenticated user.
+// @Description Adds a new todo for the authenticated user, optionally in a list they can write to. The assignee must be able to read the list and is notified by email.
 // @Tags todos
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param todo body database.TodoCreate true "Todo object"
 // @Success 201 {object} database.Todo
-// @Failure 400 {string} string "Bad Request"
-// @Failure 401 {string} string "Unauthorized
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse "List not found"
 // @Router /api/v1/todos [post]
 func (app *application) handleCreateTodo(c echo.Context) error {
 	var input database.TodoCreate
@@ -50,27 +75,24 @@ func (app *application) handleCreateTodo(c echo.Context) error {
 	}
 
 	if err := c.Validate(&input); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Code:    "VALIDATION_ERROR",
-			Message: "Validation failed",
-			Details: err.Error(),
-		})
+		return app.failedValidationResponse(c, err)
 	}
 
 	user := app.GetUserFromContext(c)
 	todo, err := app.models.Todos.Insert(&input, user.Id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Code:    "INTERNAL_ERROR",
-			Message: "Failed to create todo",
-		})
+		return createTodoErrorResponse(c, err)
+	}
+
+	if todo.AssigneeId != nil {
+		app.notifyTodoChange(user, todo, "created", true)
 	}
 
 	return c.JSON(http.StatusCreated, todo)
 }
 
 // @Summary Update a todo
-// @Description Updates the fields of a todo identified by ID.
+// @Description Updates the fields of a todo identified by ID and notifies its assignee and watchers. A new assignee must be able to read the todo; an empty assigneeId unassigns it.
 // @Tags todos
 // @Security BearerAuth
 // @Accept json
@@ -78,7 +100,7 @@ func (app *application) handleCreateTodo(c echo.Context) error {
 // @Param id path string true "Todo ID"
 // @Param todo body database.TodoPatch true "Todo object"
 // @Success 200 {object} database.Todo
-// @Failure 400 {string} string "Bad Request"
+// @Failure 400 {object} main.ValidationResponse
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Not found"
 // @Router /api/v1/todos/{id} [patch]
@@ -94,11 +116,7 @@ func (app *application) handleUpdateTodo(c echo.Context) error {
 	}
 
 	if err := c.Validate(&input); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{
-			Code:    "VALIDATION_ERROR",
-			Message: "Validation failed",
-			Details: err.Error(),
-		})
+		return app.failedValidationResponse(c, err)
 	}
 
 	user := app.GetUserFromContext(c)
@@ -111,6 +129,8 @@ func (app *application) handleUpdateTodo(c echo.Context) error {
 				Code:    "NOT_FOUND",
 				Message: "Todo not found",
 			})
+		case "invalid assignee":
+			return invalidAssigneeResponse(c)
 		case "no updates provided":
 			return c.JSON(http.StatusBadRequest, ErrorResponse{
 				Code:    "VALIDATION_ERROR",
@@ -124,11 +144,13 @@ func (app *application) handleUpdateTodo(c echo.Context) error {
 		}
 	}
 
+	app.notifyTodoChange(user, updated, "updated", input.AssigneeId != nil)
+
 	return c.JSON(http.StatusOK, updated)
 }
 
 // @Summary Delete a todo
-// @Description Deletes the todo with the specified ID.
+// @Description Deletes the todo with the specified ID along with its attachments, and notifies its assignee and watchers.
 // @Tags todos
 // @Security BearerAuth
 // @Accept json
@@ -142,6 +164,25 @@ func (app *application) handleDeleteTodo(c echo.Context) error {
 	id := c.Param("id")
 	user := app.GetUserFromContext(c)
 
+	// The watchers go with the todo, so look them up first
+	todo, err := app.models.Todos.GetOne(id, user.Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to delete todo",
+		})
+	}
+	var recipients []database.Watcher
+	if todo != nil {
+		recipients, err = app.models.Watchers.GetRecipients(id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to delete todo",
+			})
+		}
+	}
+
 	if err := app.models.Todos.Delete(id, user.Id); err != nil {
 		if err.Error() == "todo not found" {
 			return c.JSON(http.StatusNotFound, ErrorResponse{
@@ -155,5 +196,34 @@ func (app *application) handleDeleteTodo(c echo.Context) error {
 		})
 	}
 
+	app.background(func() {
+		app.sendTodoNotices(user, todo, recipients, notify.TypeTodoChanged, "deleted", false)
+	})
+	// The delete detached the todo's attachments
+	app.background(app.sweepAttachments)
+
 	return c.NoContent(http.StatusNoContent)
 }
+
+func createTodoErrorResponse(c echo.Context, err error) error {
+	switch err.Error() {
+	case "list not found":
+		return c.JSON(http.StatusNotFound, ErrorResponse{
+			Code:    ErrNotFound,
+			Message: "List not found",
+		})
+	case "invalid assignee":
+		return invalidAssigneeResponse(c)
+	}
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Code:    "INTERNAL_ERROR",
+		Message: "Failed to create todo",
+	})
+}
+
+func invalidAssigneeResponse(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, ErrorResponse{
+		Code:    ErrValidationFailed,
+		Message: "The assignee cannot access this todo",
+	})
+}
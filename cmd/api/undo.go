@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Undo the last change
+// @Description Reverses the authenticated user's latest change to their todos, if it was made recently. Each user can undo their last 20 changes, one at a time. Nothing is changed if a todo involved has been changed by anyone since; comments and attachments of a deleted todo are not brought back.
+// @Tags todos
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} database.UndoResult
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse "Nothing to undo"
+// @Failure 409 {object} main.ErrorResponse "A todo has changed since"
+// @Router /api/v1/undo [post]
+func (app *application) handleUndo(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	result, err := app.models.Undo.Undo(user.Id, app.undoTTL)
+	return app.undoResponse(c, result, err)
+}
+
+// @Summary Redo the last undone change
+// @Description Applies the change the authenticated user undid last again. Changing a todo in any other way clears what can be redone.
+// @Tags todos
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} database.UndoResult
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse "Nothing to redo"
+// @Failure 409 {object} main.ErrorResponse "A todo has changed since"
+// @Router /api/v1/redo [post]
+func (app *application) handleRedo(c echo.Context) error {
+	user := app.GetUserFromContext(c)
+	result, err := app.models.Undo.Redo(user.Id, app.undoTTL)
+	return app.undoResponse(c, result, err)
+}
+
+func (app *application) undoResponse(c echo.Context, result *database.UndoResult, err error) error {
+	if err != nil {
+		switch err.Error() {
+		case "nothing to undo":
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "There is nothing to undo",
+			})
+		case "nothing to redo":
+			return c.JSON(http.StatusNotFound, ErrorResponse{
+				Code:    ErrNotFound,
+				Message: "There is nothing to redo",
+			})
+		case "undo conflict":
+			return c.JSON(http.StatusConflict, ErrorResponse{
+				Code:    ErrConflict,
+				Message: "A todo has been changed since, or you can no longer change it",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to apply change",
+		})
+	}
+
+	if len(result.Deleted) > 0 {
+		app.background(app.sweepAttachments)
+	}
+	return c.JSON(http.StatusOK, result)
+}
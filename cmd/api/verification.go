@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	verifyEmailPurpose = "verify-email"
+	changeEmailPurpose = "change-email"
+	verifyEmailTTL     = 24 * time.Hour
+)
+
+// VerifyEmailRequest represents the email verification payload
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required" example:"eyJ1c2VySWQiOi..."`
+}
+
+// ResendVerificationRequest represents the resend verification payload
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email" example:"user@example.com"`
+}
+
+// sendVerificationEmail emails the user a signed link that confirms they own
+// their current address. The link stops working once it expires or the
+// user's email changes.
+func (app *application) sendVerificationEmail(user *database.User) error {
+	token := utils.SignToken(
+		[]byte(app.tokenSecret),
+		strings.Join([]string{verifyEmailPurpose, user.Id, user.Email}, ":"),
+		time.Now().Add(verifyEmailTTL),
+	)
+	link := fmt.Sprintf("%s/verify-email?token=%s", app.appURL, url.QueryEscape(token))
+
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not create an account you can ignore this email.\n",
+			user.Name, link, int(verifyEmailTTL.Hours())),
+	})
+}
+
+// sendEmailChangeLinks emails a link that confirms the change to the user's
+// pending address, and tells their current address about the request so
+// the owner notices if someone else made it.
+func (app *application) sendEmailChangeLinks(user *database.User) error {
+	token := utils.SignToken(
+		[]byte(app.tokenSecret),
+		strings.Join([]string{changeEmailPurpose, user.Id, *user.PendingEmail}, ":"),
+		time.Now().Add(verifyEmailTTL),
+	)
+	link := fmt.Sprintf("%s/verify-email?token=%s", app.appURL, url.QueryEscape(token))
+
+	err := app.mailer.Send(mailer.Message{
+		To:      *user.PendingEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this address for your account by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. Until then you keep signing in with %s.\n",
+			user.Name, link, int(verifyEmailTTL.Hours()), user.Email),
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your account to %s. "+
+			"It changes once the link sent to that address is opened.\n\n"+
+			"If this wasn't you, change your password now and sign out your other sessions.\n",
+			user.Name, *user.PendingEmail),
+	})
+}
+
+// @Summary Verifies an email address
+// @Description Confirms the email address of the account the token was issued for, or the new address of an email change.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body main.VerifyEmailRequest true "Verification token"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} main.ErrorResponse
+// @Failure 409 {object} main.ErrorResponse "The new address was taken in the meantime"
+// @Router /api/v1/auth/verify [post]
+func (app *application) verifyEmail(c echo.Context) error {
+	var input VerifyEmailRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	payload, err := utils.VerifyToken([]byte(app.tokenSecret), input.Token)
+	if err != nil {
+		if errors.Is(err, utils.ErrTokenExpired) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    ErrTokenExpired,
+				Message: "Verification link has expired",
+			})
+		}
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Invalid verification link",
+		})
+	}
+
+	parts := strings.SplitN(payload, ":", 3)
+	if len(parts) != 3 || (parts[0] != verifyEmailPurpose && parts[0] != changeEmailPurpose) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Invalid verification link",
+		})
+	}
+
+	if parts[0] == changeEmailPurpose {
+		return app.confirmEmailChange(c, parts[1], parts[2])
+	}
+
+	user, err := app.models.Users.Get(parts[1])
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to verify email",
+		})
+	}
+	if user == nil || user.Email != parts[2] {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    ErrInvalidToken,
+			Message: "Invalid verification link",
+		})
+	}
+
+	if err := app.models.Users.MarkEmailVerified(user.Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to verify email",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// confirmEmailChange switches the user to the pending address a change
+// email link was sent to.
+func (app *application) confirmEmailChange(c echo.Context, userId string, email string) error {
+	if err := app.models.Users.ConfirmEmailChange(userId, email); err != nil {
+		if errors.Is(err, database.ErrDuplicateEmail) {
+			return c.JSON(http.StatusConflict, ErrorResponse{
+				Code:    ErrConflict,
+				Message: "Email is already in use",
+			})
+		}
+		if err.Error() == "pending email not found" {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Code:    ErrInvalidToken,
+				Message: "Invalid verification link",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to verify email",
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Resends the verification email
+// @Description Sends a new verification link if the address belongs to an unverified account. Always responds with 202 so the endpoint cannot be used to discover accounts.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body main.ResendVerificationRequest true "Account email"
+// @Success 202 {string} string "Accepted"
+// @Failure 400 {object} main.ValidationResponse
+// @Failure 429 {object} main.ErrorResponse
+// @Router /api/v1/auth/verify/resend [post]
+func (app *application) resendVerificationEmail(c echo.Context) error {
+	if !app.verificationIPLimiter.Allow(c.RealIP()) {
+		return app.rateLimitedResponse(c)
+	}
+
+	var input ResendVerificationRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Code:    "INVALID_REQUEST",
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := c.Validate(&input); err != nil {
+		return app.failedValidationResponse(c, err)
+	}
+
+	// Throttling per address is silent so it does not reveal which
+	// addresses have accounts.
+	if !app.verificationEmailLimiter.Allow(strings.ToLower(input.Email)) {
+		return c.NoContent(http.StatusAccepted)
+	}
+
+	// The lookup and email happen in the background so that response times
+	// are the same whether or not the account exists.
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			log.Printf("resend verification: %v", err)
+			return
+		}
+		if user != nil && user.EmailVerifiedAt == nil {
+			if err := app.sendVerificationEmail(user); err != nil {
+				log.Printf("resend verification: %v", err)
+			}
+		}
+	})
+
+	return c.NoContent(http.StatusAccepted)
+}
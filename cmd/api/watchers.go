@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/notify"
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary List watchers
+// @Description Lists the users who are notified when a todo changes.
+// @Tags todos
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Success 200 {array} database.Watcher
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/watchers [get]
+func (app *application) handleGetWatchers(c echo.Context) error {
+	watchers, err := app.models.Watchers.GetForTodo(todoFromContext(c).Id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to fetch watchers",
+		})
+	}
+	return c.JSON(http.StatusOK, watchers)
+}
+
+// @Summary Watch a todo
+// @Description Notifies the authenticated user by email whenever the todo changes.
+// @Tags todos
+// @Security BearerAuth
+// @Param id path string true "Todo ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {object} main.ErrorResponse
+// @Router /api/v1/todos/{id}/watch [post]
+func (app *application) handleWatchTodo(c echo.Context) error {
+	if err := app.models.Watchers.Watch(todoFromContext(c).Id, app.GetUserFromContext(c).Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to watch todo",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary Stop watching a todo
+// @Description Stops notifying the authenticated user about changes to the todo.
+// @Tags todos
+// @Security BearerAuth
+// @Param id path string true "Todo ID"
+// @Success 204 {string} string "No Content"
+// @Failure 401 {string} string "Unauthorized"
+// @Router /api/v1/todos/{id}/watch [delete]
+func (app *application) handleUnwatchTodo(c echo.Context) error {
+	if err := app.models.Watchers.Unwatch(c.Param("id"), app.GetUserFromContext(c).Id); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Code:    ErrInternal,
+			Message: "Failed to stop watching todo",
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RequireTodo loads the todo in the :id path parameter and rejects users
+// who cannot read it with a 404.
+func (app *application) RequireTodo() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			todo, err := app.models.Todos.GetOne(c.Param("id"), app.GetUserFromContext(c).Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Code:    ErrInternal,
+					Message: "Failed to fetch todo",
+				})
+			}
+			if todo == nil {
+				return c.JSON(http.StatusNotFound, ErrorResponse{
+					Code:    ErrNotFound,
+					Message: "Todo not found",
+				})
+			}
+
+			c.Set("todo", todo)
+			return next(c)
+		}
+	}
+}
+
+// RequireTodoWriter follows RequireTodo and rejects users who can read the
+// todo but not change it.
+func (app *application) RequireTodoWriter() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ok, err := app.models.Todos.CanWrite(todoFromContext(c).Id, app.GetUserFromContext(c).Id)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, ErrorResponse{
+					Code:    ErrInternal,
+					Message: "Failed to fetch todo",
+				})
+			}
+			if !ok {
+				return c.JSON(http.StatusForbidden, ErrorResponse{
+					Code:    ErrForbidden,
+					Message: "You do not have permission to do this",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+func todoFromContext(c echo.Context) *database.Todo {
+	todo, _ := c.Get("todo").(*database.Todo)
+	return todo
+}
+
+// notifyTodoChange tells the todo's assignee and watchers, apart from the
+// actor, what happened to it. With assigned set the assignee is told they
+// were assigned instead.
+func (app *application) notifyTodoChange(actor *database.User, todo *database.Todo, verb string, assigned bool) {
+	t := *todo
+	app.background(func() {
+		recipients, err := app.models.Watchers.GetRecipients(t.Id)
+		if err != nil {
+			log.Printf("todo notification: %v", err)
+			return
+		}
+		app.sendTodoNotices(actor, &t, recipients, notify.TypeTodoChanged, verb, assigned)
+	})
+}
+
+// sendTodoNotices notifies the recipients other than the actor of what the
+// actor did to the todo.
+func (app *application) sendTodoNotices(actor *database.User, todo *database.Todo, recipients []database.Watcher, typ string, verb string, assigned bool) {
+	for _, r := range recipients {
+		if r.UserId == actor.Id {
+			continue
+		}
+		t, v := typ, verb
+		if assigned && todo.AssigneeId != nil && *todo.AssigneeId == r.UserId {
+			t, v = notify.TypeAssigned, "assigned you to"
+		}
+		todoId := todo.Id
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := app.notifier.Notify(ctx, &notify.Notification{
+			UserId: r.UserId,
+			Name:   r.Name,
+			Email:  r.Email,
+			Type:   t,
+			Title:  fmt.Sprintf("%s %s \"%s\"", actor.Name, v, todo.Title),
+			Body:   fmt.Sprintf("%s %s the todo \"%s\".", actor.Name, v, todo.Title),
+			TodoId: &todoId,
+			URL:    app.appURL,
+		})
+		cancel()
+		if err != nil {
+			log.Printf("todo notification: %v", err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by Get when there is no blob under the key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps file contents outside the database. Keys are chosen by the
+// caller and only contain letters, digits, dashes and slashes.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
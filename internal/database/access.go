@@ -0,0 +1,77 @@
+package database
+
+import "fmt"
+
+// Organisation roles, from most to least privileged. Owners and admins
+// manage the organisation and its members, members work on its lists and
+// guests can only read them.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+	OrgRoleGuest  = "guest"
+)
+
+var orgRoleRank = map[string]int{
+	OrgRoleGuest:  1,
+	OrgRoleMember: 2,
+	OrgRoleAdmin:  3,
+	OrgRoleOwner:  4,
+}
+
+// OrgRoleAtLeast reports whether role grants at least the rights of min.
+func OrgRoleAtLeast(role, min string) bool {
+	return orgRoleRank[role] >= orgRoleRank[min]
+}
+
+// Roles a list can be shared with. Owners can also share and delete the
+// list, editors can change its todos and viewers can only read them.
+const (
+	ShareRoleOwner  = "owner"
+	ShareRoleEditor = "editor"
+	ShareRoleViewer = "viewer"
+)
+
+// listAccess returns a SQL condition that holds when the user in userParam
+// may read, or with write also change, the list whose id is in listColumn.
+// Every query on lists and todos goes through it so the rules live in one
+// place.
+func listAccess(listColumn string, userParam string, write bool) string {
+	orgRoles := `'owner', 'admin', 'member', 'guest'`
+	shareRoles := `'owner', 'editor', 'viewer'`
+	if write {
+		orgRoles = `'owner', 'admin', 'member'`
+		shareRoles = `'owner', 'editor'`
+	}
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM lists acl_l
+		LEFT JOIN organisation_members acl_m
+			ON acl_m.organisation_id = acl_l.organisation_id AND acl_m.user_id = %[2]s
+		LEFT JOIN list_shares acl_s
+			ON acl_s.list_id = acl_l.id AND acl_s.user_id = %[2]s
+		WHERE acl_l.id = %[1]s
+			AND (acl_l.owner_id = %[2]s OR acl_m.role IN (%[3]s) OR acl_s.role IN (%[4]s)))`,
+		listColumn, userParam, orgRoles, shareRoles)
+}
+
+// listManage is like listAccess but for deleting and sharing the list: the
+// owner of a personal list, anyone it was shared with as owner, and the
+// owners and admins of the list's organisation.
+func listManage(listColumn string, userParam string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM lists acl_l
+		LEFT JOIN organisation_members acl_m
+			ON acl_m.organisation_id = acl_l.organisation_id AND acl_m.user_id = %[2]s
+		LEFT JOIN list_shares acl_s
+			ON acl_s.list_id = acl_l.id AND acl_s.user_id = %[2]s
+		WHERE acl_l.id = %[1]s
+			AND (acl_l.owner_id = %[2]s OR acl_m.role IN ('owner', 'admin') OR acl_s.role = 'owner'))`,
+		listColumn, userParam)
+}
+
+// todoAccess is listAccess for todos. Todos outside any list are private
+// to the user who created them.
+func todoAccess(alias string, userParam string, write bool) string {
+	return fmt.Sprintf(`((%[1]s.list_id IS NULL AND %[1]s.user_id = %[2]s) OR %[3]s)`,
+		alias, userParam, listAccess(alias+".list_id", userParam, write))
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type AdminModel struct {
+	DB *sql.DB
+}
+
+// AdminUser is a user as shown to administrators, with their todo counts.
+type AdminUser struct {
+	User
+	TodoCount          int `json:"todoCount" example:"12"`
+	CompletedTodoCount int `json:"completedTodoCount" example:"7"`
+}
+
+// AuditEntry records an action an administrator took.
+type AuditEntry struct {
+	Id           string    `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ActorId      *string   `json:"actorId,omitempty"`
+	Action       string    `json:"action" example:"user.disable"`
+	TargetUserId *string   `json:"targetUserId,omitempty"`
+	IPAddress    string    `json:"ipAddress" example:"203.0.113.7"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// adminUserQuery selects users with their todo counts. Callers add the
+// WHERE clause.
+const adminUserQuery = `
+	SELECT ` + userColumns + `,
+		(SELECT COUNT(*) FROM todos t WHERE t.user_id = users.id),
+		(SELECT COUNT(*) FROM todos t WHERE t.user_id = users.id AND t.is_completed)
+	FROM users`
+
+func scanAdminUser(row interface{ Scan(...interface{}) error }) (*AdminUser, error) {
+	var u AdminUser
+	err := row.Scan(
+		&u.Id, &u.Email, &u.Name, &u.Password, &u.TimeZone, &u.Locale, &u.CreatedAt, &u.UpdatedAt,
+		&u.EmailVerifiedAt, &u.PendingEmail, &u.TokensRevokedAt, &u.TokenVersion, &u.TOTPSecret, &u.TOTPEnabledAt, &u.Role, &u.DisabledAt,
+		&u.TodoCount, &u.CompletedTodoCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SearchUsers returns a page of users whose email or name contains search,
+// newest first, and the total number of matches.
+func (m *AdminModel) SearchUsers(search string, limit, offset int) ([]AdminUser, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pattern := "%" + search + "%"
+
+	var total int
+	err := m.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM users WHERE email ILIKE $1 OR name ILIKE $1`,
+		pattern,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	rows, err := m.DB.QueryContext(ctx,
+		adminUserQuery+` WHERE email ILIKE $1 OR name ILIKE $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`,
+		pattern, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
+		}
+		users = append(users, *u)
+	}
+	return users, total, rows.Err()
+}
+
+func (m *AdminModel) GetUser(id string) (*AdminUser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	u, err := scanAdminUser(m.DB.QueryRowContext(ctx, adminUserQuery+` WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+func (m *AdminModel) InsertAuditEntry(entry *AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO admin_audit_log (actor_id, action, target_user_id, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		entry.ActorId, entry.Action, entry.TargetUserId, entry.IPAddress,
+	).Scan(&entry.Id, &entry.CreatedAt)
+}
+
+// GetAuditLog returns the most recent admin actions, optionally only those
+// that targeted one user.
+func (m *AdminModel) GetAuditLog(targetUserId string, limit int) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT id, actor_id, action, target_user_id, ip_address, created_at
+		FROM admin_audit_log
+		WHERE $1 = '' OR target_user_id::text = $1
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		targetUserId, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.Id, &e.ActorId, &e.Action, &e.TargetUserId, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APITokenModel struct {
+	DB *sql.DB
+}
+
+// APIToken is a personal access token a user created for scripts and
+// integrations. Only a hash of the secret is stored.
+type APIToken struct {
+	Id          string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	UserId      string     `json:"-"`
+	Name        string     `json:"name" example:"Backup script"`
+	TokenHash   []byte     `json:"-"`
+	TokenPrefix string     `json:"tokenPrefix" example:"todo_pat_x7Kq"`
+	Scopes      []string   `json:"scopes" example:"todos:read"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+const apiTokenColumns = `id, user_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, created_at`
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes pq.StringArray
+	err := row.Scan(&t.Id, &t.UserId, &t.Name, &t.TokenHash, &t.TokenPrefix, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Scopes = scopes
+	return &t, nil
+}
+
+func (m *APITokenModel) Insert(token *APIToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		token.UserId, token.Name, token.TokenHash, token.TokenPrefix, pq.StringArray(token.Scopes), token.ExpiresAt,
+	).Scan(&token.Id, &token.CreatedAt)
+}
+
+func (m *APITokenModel) GetAllForUser(userId string) ([]APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx,
+		`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// GetActiveByHash returns the unexpired token with the given hash, or nil if
+// there is none. Tokens created before the user's tokens were last revoked,
+// e.g. by a password reset, are not active.
+func (m *APITokenModel) GetActiveByHash(tokenHash []byte) (*APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, t.name, t.token_hash, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.created_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+			AND (t.expires_at IS NULL OR t.expires_at > CURRENT_TIMESTAMP)
+			AND (u.tokens_revoked_at IS NULL OR t.created_at >= u.tokens_revoked_at)`,
+		tokenHash,
+	)
+
+	t, err := scanAPIToken(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// Touch records that the token was used. Writes are limited to one a
+// minute per token so busy scripts do not cause a write on every request.
+func (m *APITokenModel) Touch(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE api_tokens
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+func (m *APITokenModel) Delete(id string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userId)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// DeleteAllForUser deletes every token of the user.
+func (m *APITokenModel) DeleteAllForUser(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE user_id = $1`, userId)
+	return err
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+// Attachment is a file uploaded to a todo. The contents live in blob
+// storage under StorageKey.
+type Attachment struct {
+	Id          string    `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	TodoId      *string   `json:"todoId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	UploaderId  *string   `json:"uploaderId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Filename    string    `json:"filename" example:"receipt.pdf"`
+	ContentType string    `json:"contentType" example:"application/pdf"`
+	Size        int64     `json:"size" example:"48213"`
+	SHA256      []byte    `json:"-"`
+	Checksum    string    `json:"sha256" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	StorageKey  string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+const attachmentColumns = `id, todo_id, uploader_id, filename, content_type, size_bytes, sha256, storage_key, created_at`
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (*Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.Id, &a.TodoId, &a.UploaderId, &a.Filename, &a.ContentType, &a.Size,
+		&a.SHA256, &a.StorageKey, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	a.Checksum = hex.EncodeToString(a.SHA256)
+	return &a, nil
+}
+
+func (m *AttachmentModel) Insert(a *Attachment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO attachments (todo_id, uploader_id, filename, content_type, size_bytes, sha256, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	a.Checksum = hex.EncodeToString(a.SHA256)
+	return m.DB.QueryRowContext(ctx, query,
+		a.TodoId, a.UploaderId, a.Filename, a.ContentType, a.Size, a.SHA256, a.StorageKey,
+	).Scan(&a.Id, &a.CreatedAt)
+}
+
+func (m *AttachmentModel) GetForTodo(todoId string) ([]Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE todo_id = $1
+		ORDER BY created_at`,
+		todoId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanAttachments(rows)
+}
+
+// Get returns the attachment if it belongs to the todo, or nil otherwise.
+func (m *AttachmentModel) Get(id string, todoId string) (*Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx,
+		`SELECT `+attachmentColumns+` FROM attachments WHERE id = $1 AND todo_id = $2`,
+		id, todoId,
+	)
+
+	a, err := scanAttachment(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// Detach takes an attachment off its todo. Its file is removed later along
+// with those of deleted todos, see GetDetached.
+func (m *AttachmentModel) Detach(id string, todoId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`UPDATE attachments SET todo_id = NULL WHERE id = $1 AND todo_id = $2`,
+		id, todoId,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("attachment not found")
+	}
+	return nil
+}
+
+// GetDetached returns up to limit attachments whose todo is gone, so their
+// files can be deleted.
+func (m *AttachmentModel) GetDetached(limit int) ([]Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE todo_id IS NULL
+		ORDER BY created_at
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanAttachments(rows)
+}
+
+// Delete removes the row of a detached attachment once its file is gone.
+func (m *AttachmentModel) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM attachments WHERE id = $1 AND todo_id IS NULL`, id)
+	return err
+}
+
+func scanAttachments(rows *sql.Rows) ([]Attachment, error) {
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		attachments = append(attachments, *a)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Comment is a message in the discussion on a todo. The author is empty
+// once their account has been deleted.
+type Comment struct {
+	Id         string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	TodoId     string     `json:"todoId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	AuthorId   *string    `json:"authorId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	AuthorName string     `json:"authorName,omitempty" example:"Jane Doe"`
+	Body       string     `json:"body" example:"I'll pick these up on the way home @sam"`
+	EditedAt   *time.Time `json:"editedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+const commentColumns = `c.id, c.todo_id, c.author_id, COALESCE(u.name, ''), c.body, c.edited_at, c.created_at`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (*Comment, error) {
+	var cm Comment
+	err := row.Scan(&cm.Id, &cm.TodoId, &cm.AuthorId, &cm.AuthorName, &cm.Body, &cm.EditedAt, &cm.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &cm, nil
+}
+
+func (m *CommentModel) Insert(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO comments (todo_id, author_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query, comment.TodoId, comment.AuthorId, comment.Body).Scan(&comment.Id, &comment.CreatedAt)
+}
+
+// GetForTodo returns a page of the todo's comments, oldest first, and how
+// many comments there are in total.
+func (m *CommentModel) GetForTodo(todoId string, limit, offset int) ([]Comment, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM comments WHERE todo_id = $1`, todoId).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.todo_id = $1
+		ORDER BY c.created_at, c.id
+		LIMIT $2 OFFSET $3`,
+		todoId, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		cm, err := scanComment(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
+		}
+		comments = append(comments, *cm)
+	}
+	return comments, total, rows.Err()
+}
+
+// Update changes the body of a comment by authorId that is younger than
+// window. Older comments give "edit window passed".
+func (m *CommentModel) Update(id string, todoId string, authorId string, body string, window time.Duration) (*Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		WITH updated AS (
+			UPDATE comments
+			SET body = $4, edited_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND todo_id = $2 AND author_id = $3
+				AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $5)
+			RETURNING *
+		)
+		SELECT `+commentColumns+`
+		FROM updated c
+		LEFT JOIN users u ON u.id = c.author_id`,
+		id, todoId, authorId, body, window.Seconds(),
+	)
+
+	cm, err := scanComment(row)
+	if err == nil {
+		return cm, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("update failed: %w", err)
+	}
+
+	var exists bool
+	err = m.DB.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM comments WHERE id = $1 AND todo_id = $2 AND author_id = $3)`,
+		id, todoId, authorId,
+	).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("edit window passed")
+	}
+	return nil, fmt.Errorf("comment not found")
+}
+
+// Delete removes a comment. Authors can delete their own comments and
+// whoever can manage the todo's list can delete any of them.
+func (m *CommentModel) Delete(id string, todoId string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `
+		DELETE FROM comments c
+		USING todos t
+		WHERE c.id = $1 AND c.todo_id = $2 AND t.id = c.todo_id
+			AND (c.author_id = $3 OR `+listManage("t.list_id", "$3")+`)`,
+		id, todoId, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("comment not found")
+	}
+	return nil
+}
+
+// GetMentionable resolves mention handles to the users who can read the
+// todo. A handle is an email address or the part of one before the @.
+func (m *CommentModel) GetMentionable(todoId string, handles []string) ([]Watcher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email
+		FROM users u, todos t
+		WHERE t.id = $1 AND u.disabled_at IS NULL
+			AND (lower(u.email) = ANY($2) OR lower(split_part(u.email, '@', 1)) = ANY($2))
+			AND `+todoAccess("t", "u.id", false),
+		todoId, pq.StringArray(handles),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanWatchers(rows)
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// IdentityModel links users to accounts at external OpenID Connect providers.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// GetUserId returns the user linked to the provider's subject, or an empty
+// string if there is none.
+func (m *IdentityModel) GetUserId(provider string, subject string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userId string
+	err := m.DB.QueryRowContext(ctx,
+		`SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`,
+		provider, subject,
+	).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return userId, nil
+}
+
+func (m *IdentityModel) Insert(userId string, provider string, subject string, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO NOTHING`
+
+	_, err := m.DB.ExecContext(ctx, query, userId, provider, subject, email)
+	return err
+}
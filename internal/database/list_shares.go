@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ListShareModel struct {
+	DB *sql.DB
+}
+
+// ListShare gives one user access to a list outside of any organisation.
+type ListShare struct {
+	UserId    string    `json:"userId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name      string    `json:"name" example:"Jane Doe"`
+	Email     string    `json:"email" example:"jane@example.com"`
+	Role      string    `json:"role" example:"editor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SharedList is a list together with the role it was shared with.
+type SharedList struct {
+	List
+	Role string `json:"role" example:"editor"`
+}
+
+// ShareInvitation asks someone to accept access to a list. Only a hash of
+// the accept token is stored.
+type ShareInvitation struct {
+	Id         string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ListId     string     `json:"listId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Email      string     `json:"email" example:"sam@example.com"`
+	Role       string     `json:"role" example:"editor"`
+	TokenHash  []byte     `json:"-"`
+	InvitedBy  *string    `json:"invitedBy,omitempty"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	AcceptedAt *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (m *ListShareModel) GetForList(listId string) ([]ListShare, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email, ls.role, ls.created_at
+		FROM list_shares ls
+		JOIN users u ON u.id = ls.user_id
+		WHERE ls.list_id = $1
+		ORDER BY u.name`,
+		listId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []ListShare{}
+	for rows.Next() {
+		var s ListShare
+		if err := rows.Scan(&s.UserId, &s.Name, &s.Email, &s.Role, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+// GetSharedWithUser lists the lists other people have shared with the user.
+func (m *ListShareModel) GetSharedWithUser(userId string) ([]SharedList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT l.id, l.name, l.organisation_id, l.owner_id, l.created_at, ls.role
+		FROM list_shares ls
+		JOIN lists l ON l.id = ls.list_id
+		WHERE ls.user_id = $1
+		ORDER BY l.name`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	lists := []SharedList{}
+	for rows.Next() {
+		var s SharedList
+		err := rows.Scan(&s.Id, &s.Name, &s.OrganisationId, &s.OwnerId, &s.CreatedAt, &s.Role)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		lists = append(lists, s)
+	}
+	return lists, rows.Err()
+}
+
+// GetSharedList returns the list as shared with the user, or nil if it
+// was not shared with them.
+func (m *ListShareModel) GetSharedList(listId string, userId string) (*SharedList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s SharedList
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT l.id, l.name, l.organisation_id, l.owner_id, l.created_at, ls.role
+		FROM list_shares ls
+		JOIN lists l ON l.id = ls.list_id
+		WHERE ls.list_id = $1 AND ls.user_id = $2`,
+		listId, userId,
+	).Scan(&s.Id, &s.Name, &s.OrganisationId, &s.OwnerId, &s.CreatedAt, &s.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *ListShareModel) UpdateRole(listId string, userId string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`UPDATE list_shares SET role = $3 WHERE list_id = $1 AND user_id = $2`,
+		listId, userId, role,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	return checkShareChange(res)
+}
+
+func (m *ListShareModel) Delete(listId string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`DELETE FROM list_shares WHERE list_id = $1 AND user_id = $2`,
+		listId, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return checkShareChange(res)
+}
+
+func checkShareChange(res sql.Result) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("share not found")
+	}
+	return nil
+}
+
+func (m *ListShareModel) InsertInvitation(inv *ShareInvitation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO list_share_invitations (list_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		inv.ListId, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt,
+	).Scan(&inv.Id, &inv.CreatedAt)
+}
+
+const shareInvitationColumns = `id, list_id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at`
+
+func scanShareInvitation(row interface{ Scan(...interface{}) error }) (*ShareInvitation, error) {
+	var inv ShareInvitation
+	err := row.Scan(&inv.Id, &inv.ListId, &inv.Email, &inv.Role, &inv.TokenHash,
+		&inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetPendingInvitations lists the invitations to the list that have not
+// been accepted and have not expired.
+func (m *ListShareModel) GetPendingInvitations(listId string) ([]ShareInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+shareInvitationColumns+`
+		FROM list_share_invitations
+		WHERE list_id = $1 AND accepted_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC`,
+		listId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []ShareInvitation{}
+	for rows.Next() {
+		inv, err := scanShareInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// GetPendingInvitationByHash returns the usable invitation with the given
+// token hash, or nil if there is none.
+func (m *ListShareModel) GetPendingInvitationByHash(tokenHash []byte) (*ShareInvitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT `+shareInvitationColumns+`
+		FROM list_share_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > CURRENT_TIMESTAMP`,
+		tokenHash,
+	)
+
+	inv, err := scanShareInvitation(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+// AcceptInvitation shares the invitation's list with the user and marks
+// the invitation used. A user the list is already shared with gets the
+// invitation's role.
+func (m *ListShareModel) AcceptInvitation(inv *ShareInvitation, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE list_share_invitations
+		SET accepted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND accepted_at IS NULL`,
+		inv.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO list_shares (list_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (list_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+		inv.ListId, userId, inv.Role,
+	)
+	if err != nil {
+		return fmt.Errorf("insert share failed: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (m *ListShareModel) DeleteInvitation(id string, listId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`DELETE FROM list_share_invitations WHERE id = $1 AND list_id = $2 AND accepted_at IS NULL`,
+		id, listId,
+	)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+	return nil
+}
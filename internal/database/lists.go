@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+// List groups todos. A list belongs either to one user or to an
+// organisation, in which case every member can see it. Either kind can
+// also be shared with individual users.
+type List struct {
+	Id             string    `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name           string    `json:"name" example:"Groceries"`
+	OrganisationId *string   `json:"organisationId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	OwnerId        *string   `json:"ownerId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type ListCreate struct {
+	Name           string  `json:"name" validate:"required,max=255" example:"Groceries"`
+	OrganisationId *string `json:"organisationId,omitempty" validate:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+type ListPatch struct {
+	Name string `json:"name" validate:"required,max=255" example:"Weekly groceries"`
+}
+
+const listColumns = `id, name, organisation_id, owner_id, created_at`
+
+func scanList(row interface{ Scan(...interface{}) error }) (*List, error) {
+	var l List
+	if err := row.Scan(&l.Id, &l.Name, &l.OrganisationId, &l.OwnerId, &l.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (m *ListModel) Insert(list *List) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO lists (name, organisation_id, owner_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query, list.Name, list.OrganisationId, list.OwnerId).Scan(&list.Id, &list.CreatedAt)
+}
+
+// GetAllForUser lists every list the user can read.
+func (m *ListModel) GetAllForUser(userId string) ([]List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+listColumns+`
+		FROM lists l
+		WHERE `+listAccess("l.id", "$1", false)+`
+		ORDER BY name`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		l, err := scanList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		lists = append(lists, *l)
+	}
+	return lists, rows.Err()
+}
+
+// Get returns the list if the user can read it, or nil otherwise.
+func (m *ListModel) Get(id string, userId string) (*List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT `+listColumns+`
+		FROM lists l
+		WHERE l.id = $1 AND `+listAccess("l.id", "$2", false),
+		id, userId,
+	)
+
+	l, err := scanList(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetById returns the list without any access check, or nil if there is
+// none. Callers must have authorised the request some other way.
+func (m *ListModel) GetById(id string) (*List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `SELECT `+listColumns+` FROM lists WHERE id = $1`, id)
+
+	l, err := scanList(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// CanWrite reports whether the user may add and change todos in the list.
+func (m *ListModel) CanWrite(id string, userId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ok bool
+	err := m.DB.QueryRowContext(ctx, `SELECT `+listAccess("$1", "$2", true), id, userId).Scan(&ok)
+	return ok, err
+}
+
+// Rename changes the name of a list the user can write to.
+func (m *ListModel) Rename(id string, name string, userId string) (*List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		UPDATE lists l
+		SET name = $1
+		WHERE l.id = $2 AND `+listAccess("l.id", "$3", true)+`
+		RETURNING `+listColumns,
+		name, id, userId,
+	)
+
+	l, err := scanList(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("list not found")
+		}
+		return nil, fmt.Errorf("update failed: %w", err)
+	}
+	return l, nil
+}
+
+// CanManage reports whether the user may share and delete the list.
+func (m *ListModel) CanManage(id string, userId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ok bool
+	err := m.DB.QueryRowContext(ctx, `SELECT `+listManage("$1", "$2"), id, userId).Scan(&ok)
+	return ok, err
+}
+
+// Delete removes a list and its todos if the user may manage it.
+func (m *ListModel) Delete(id string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM lists l WHERE l.id = $1 AND ` + listManage("l.id", "$2")
+
+	res, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("list not found")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Reasons a login attempt is recorded as failed.
+const (
+	LoginFailureUnknownEmail  = "unknown_email"
+	LoginFailureWrongPassword = "wrong_password"
+	LoginFailureLockedOut     = "locked_out"
+)
+
+// LoginFailure is an audit record of a rejected login attempt.
+type LoginFailure struct {
+	Id        string
+	Email     string
+	UserId    *string
+	Reason    string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+func (m *LoginFailureModel) Insert(f *LoginFailure) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO login_failures (email, user_id, reason, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		f.Email, f.UserId, f.Reason, f.IPAddress, f.UserAgent,
+	).Scan(&f.Id, &f.CreatedAt)
+}
@@ -6,14 +6,54 @@ import (
 
 // Models holds all models for the application
 type Models struct {
-	Todos TodoModel
-	Users UserModel
+	Todos             TodoModel
+	Users             UserModel
+	PasswordResets    PasswordResetModel
+	RecoveryCodes     RecoveryCodeModel
+	Passkeys          PasskeyModel
+	Identities        IdentityModel
+	APITokens         APITokenModel
+	Sessions          SessionModel
+	LoginFailures     LoginFailureModel
+	Admin             AdminModel
+	Organisations     OrganisationModel
+	Lists             ListModel
+	ListShares        ListShareModel
+	PublicLinks       PublicLinkModel
+	Watchers          WatcherModel
+	Comments          CommentModel
+	Attachments       AttachmentModel
+	Undo              UndoModel
+	Reminders         ReminderModel
+	PushSubscriptions PushSubscriptionModel
+	Notifications     NotificationModel
+	NotificationPrefs NotificationPreferenceModel
 }
 
 // NewModels initializes all models with a database connection
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Todos: TodoModel{DB: db},
-		Users: UserModel{DB: db},
+		Todos:             TodoModel{DB: db},
+		Users:             UserModel{DB: db},
+		PasswordResets:    PasswordResetModel{DB: db},
+		RecoveryCodes:     RecoveryCodeModel{DB: db},
+		Passkeys:          PasskeyModel{DB: db},
+		Identities:        IdentityModel{DB: db},
+		APITokens:         APITokenModel{DB: db},
+		Sessions:          SessionModel{DB: db},
+		LoginFailures:     LoginFailureModel{DB: db},
+		Admin:             AdminModel{DB: db},
+		Organisations:     OrganisationModel{DB: db},
+		Lists:             ListModel{DB: db},
+		ListShares:        ListShareModel{DB: db},
+		PublicLinks:       PublicLinkModel{DB: db},
+		Watchers:          WatcherModel{DB: db},
+		Comments:          CommentModel{DB: db},
+		Attachments:       AttachmentModel{DB: db},
+		Undo:              UndoModel{DB: db},
+		Reminders:         ReminderModel{DB: db},
+		PushSubscriptions: PushSubscriptionModel{DB: db},
+		Notifications:     NotificationModel{DB: db},
+		NotificationPrefs: NotificationPreferenceModel{DB: db},
 	}
 }
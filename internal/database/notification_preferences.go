@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type NotificationPreferenceModel struct {
+	DB *sql.DB
+}
+
+// NotificationPreference turns one type of notification on or off on one
+// channel for a user.
+type NotificationPreference struct {
+	Type    string
+	Channel string
+	Enabled bool
+}
+
+// GetForUser returns the preferences the user has set. Anything not
+// returned is on.
+func (m *NotificationPreferenceModel) GetForUser(userId string) ([]NotificationPreference, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx,
+		`SELECT type, channel, enabled FROM notification_preferences WHERE user_id = $1`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	prefs := []NotificationPreference{}
+	for rows.Next() {
+		var p NotificationPreference
+		if err := rows.Scan(&p.Type, &p.Channel, &p.Enabled); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		prefs = append(prefs, p)
+	}
+	return prefs, rows.Err()
+}
+
+// Set saves the given preferences, leaving the user's others as they are.
+func (m *NotificationPreferenceModel) Set(userId string, prefs []NotificationPreference) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, p := range prefs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, type, channel, enabled)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, type, channel) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			userId, p.Type, p.Channel, p.Enabled,
+		)
+		if err != nil {
+			return fmt.Errorf("upsert failed: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+// DisabledChannels returns the channels the user turned off for a type of
+// notification.
+func (m *NotificationPreferenceModel) DisabledChannels(userId string, typ string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx,
+		`SELECT channel FROM notification_preferences WHERE user_id = $1 AND type = $2 AND NOT enabled`,
+		userId, typ,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	channels := []string{}
+	for rows.Next() {
+		var channel string
+		if err := rows.Scan(&channel); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// NotificationsChannel is the Postgres channel a NotificationEvent is
+// published on whenever a notification is added, so that every API process
+// can pass it on to the user's open streams.
+const NotificationsChannel = "notifications"
+
+// NotificationEvent is the payload published on NotificationsChannel.
+type NotificationEvent struct {
+	Id     string `json:"id"`
+	UserId string `json:"userId"`
+}
+
+// Notification is an entry in a user's in-app inbox.
+type Notification struct {
+	Id        string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	UserId    string     `json:"-"`
+	Type      string     `json:"type" example:"reminder"`
+	Title     string     `json:"title" example:"Reminder: Pay rent"`
+	Body      string     `json:"body" example:"Due Sun, 1 Jun 09:00"`
+	TodoId    *string    `json:"todoId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	URL       string     `json:"url,omitempty" example:"https://todo.example.com"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+const notificationColumns = `id, user_id, type, title, body, todo_id, url, read_at, created_at`
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (*Notification, error) {
+	var n Notification
+	err := row.Scan(&n.Id, &n.UserId, &n.Type, &n.Title, &n.Body, &n.TodoId, &n.URL, &n.ReadAt, &n.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// Insert adds a notification to the user's inbox and announces it on
+// NotificationsChannel. A todo that has been deleted in the meantime is
+// left out rather than failing the insert.
+func (m *NotificationModel) Insert(n *Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO notifications (user_id, type, title, body, todo_id, url)
+		VALUES ($1, $2, $3, $4, (SELECT id FROM todos WHERE id = $5), $6)
+		RETURNING id, todo_id, created_at`
+
+	err = tx.QueryRowContext(ctx, query, n.UserId, n.Type, n.Title, n.Body, n.TodoId, n.URL).Scan(&n.Id, &n.TodoId, &n.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(NotificationEvent{Id: n.Id, UserId: n.UserId})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, NotificationsChannel, string(payload)); err != nil {
+		return fmt.Errorf("notify failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+	return nil
+}
+
+func (m *NotificationModel) Get(id string) (*Notification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	n, err := scanNotification(m.DB.QueryRowContext(ctx,
+		`SELECT `+notificationColumns+` FROM notifications WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return n, nil
+}
+
+// GetForUser returns a page of the user's notifications, newest first,
+// with how many match in total and how many are unread.
+func (m *NotificationModel) GetForUser(userId string, unreadOnly bool, limit, offset int) ([]Notification, int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total, unread int
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE NOT $2 OR read_at IS NULL), COUNT(*) FILTER (WHERE read_at IS NULL)
+		FROM notifications
+		WHERE user_id = $1`,
+		userId, unreadOnly,
+	).Scan(&total, &unread)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4`,
+		userId, unreadOnly, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("scan failed: %w", err)
+		}
+		notifications = append(notifications, *n)
+	}
+	return notifications, total, unread, rows.Err()
+}
+
+// MarkRead marks one of the user's notifications read. Marking it again
+// keeps the time it was first read.
+func (m *NotificationModel) MarkRead(id string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = $1 AND user_id = $2`,
+		id, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("notification not found")
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user read.
+func (m *NotificationModel) MarkAllRead(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`, userId)
+	return err
+}
@@ -0,0 +1,424 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type OrganisationModel struct {
+	DB *sql.DB
+}
+
+// Organisation is a team workspace whose lists are shared by its members.
+type Organisation struct {
+	Id        string    `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name      string    `json:"name" example:"Acme Inc."`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Membership is an organisation together with the role the user has in it.
+type Membership struct {
+	Organisation
+	Role string `json:"role" example:"member"`
+}
+
+// Member is a user who belongs to an organisation.
+type Member struct {
+	UserId    string    `json:"userId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name      string    `json:"name" example:"Jane Doe"`
+	Email     string    `json:"email" example:"jane@example.com"`
+	Role      string    `json:"role" example:"member"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Invitation asks someone to join an organisation. Only a hash of the
+// accept token is stored.
+type Invitation struct {
+	Id             string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	OrganisationId string     `json:"organisationId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Email          string     `json:"email" example:"sam@example.com"`
+	Role           string     `json:"role" example:"member"`
+	TokenHash      []byte     `json:"-"`
+	InvitedBy      *string    `json:"invitedBy,omitempty"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	AcceptedAt     *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// Insert creates the organisation and makes ownerId its owner.
+func (m *OrganisationModel) Insert(org *Organisation, ownerId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO organisations (name) VALUES ($1) RETURNING id, created_at`,
+		org.Name,
+	).Scan(&org.Id, &org.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert failed: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organisation_members (organisation_id, user_id, role) VALUES ($1, $2, 'owner')`,
+		org.Id, ownerId,
+	)
+	if err != nil {
+		return fmt.Errorf("insert member failed: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetForUser lists the organisations the user belongs to.
+func (m *OrganisationModel) GetForUser(userId string) ([]Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT o.id, o.name, o.created_at, om.role
+		FROM organisations o
+		JOIN organisation_members om ON om.organisation_id = o.id
+		WHERE om.user_id = $1
+		ORDER BY o.name`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	memberships := []Membership{}
+	for rows.Next() {
+		var ms Membership
+		if err := rows.Scan(&ms.Id, &ms.Name, &ms.CreatedAt, &ms.Role); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		memberships = append(memberships, ms)
+	}
+	return memberships, rows.Err()
+}
+
+// GetMembership returns the organisation with the user's role in it, or nil
+// if the user is not a member.
+func (m *OrganisationModel) GetMembership(id string, userId string) (*Membership, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ms Membership
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT o.id, o.name, o.created_at, om.role
+		FROM organisations o
+		JOIN organisation_members om ON om.organisation_id = o.id
+		WHERE o.id = $1 AND om.user_id = $2`,
+		id, userId,
+	).Scan(&ms.Id, &ms.Name, &ms.CreatedAt, &ms.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ms, nil
+}
+
+func (m *OrganisationModel) Rename(id string, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE organisations SET name = $1 WHERE id = $2`, name, id)
+	return err
+}
+
+// Delete removes the organisation with its lists, todos and memberships.
+func (m *OrganisationModel) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM organisations WHERE id = $1`, id)
+	return err
+}
+
+func (m *OrganisationModel) GetMembers(id string) ([]Member, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email, om.role, om.created_at
+		FROM organisation_members om
+		JOIN users u ON u.id = om.user_id
+		WHERE om.organisation_id = $1
+		ORDER BY u.name`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var mb Member
+		if err := rows.Scan(&mb.UserId, &mb.Name, &mb.Email, &mb.Role, &mb.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		members = append(members, mb)
+	}
+	return members, rows.Err()
+}
+
+// UpdateMemberRole changes a member's role. It refuses to leave the
+// organisation without an owner.
+func (m *OrganisationModel) UpdateMemberRole(id string, userId string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != OrgRoleOwner {
+		if err := checkNotLastOwner(ctx, tx, id, userId); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE organisation_members
+		SET role = $3
+		WHERE organisation_id = $1 AND user_id = $2`,
+		id, userId, role,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	if err := checkMemberFound(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMember takes a user out of the organisation. Like UpdateMemberRole
+// it refuses to remove the last owner.
+func (m *OrganisationModel) RemoveMember(id string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotLastOwner(ctx, tx, id, userId); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM organisation_members WHERE organisation_id = $1 AND user_id = $2`,
+		id, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	if err := checkMemberFound(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkNotLastOwner fails if userId is the only owner of the organisation.
+// The owner rows stay locked until tx ends, so two owners cannot step down
+// at the same time and leave none behind.
+func checkNotLastOwner(ctx context.Context, tx *sql.Tx, id string, userId string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id FROM organisation_members
+		WHERE organisation_id = $1 AND role = 'owner'
+		FOR UPDATE`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	owners := 0
+	isOwner := false
+	for rows.Next() {
+		var ownerId string
+		if err := rows.Scan(&ownerId); err != nil {
+			return fmt.Errorf("scan failed: %w", err)
+		}
+		owners++
+		isOwner = isOwner || ownerId == userId
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if isOwner && owners == 1 {
+		return fmt.Errorf("last owner")
+	}
+	return nil
+}
+
+func checkMemberFound(res sql.Result) error {
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("member not found")
+	}
+	return nil
+}
+
+func (m *OrganisationModel) InsertInvitation(inv *Invitation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO organisation_invitations (organisation_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		inv.OrganisationId, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt,
+	).Scan(&inv.Id, &inv.CreatedAt)
+}
+
+const invitationColumns = `id, organisation_id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at`
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*Invitation, error) {
+	var inv Invitation
+	err := row.Scan(&inv.Id, &inv.OrganisationId, &inv.Email, &inv.Role, &inv.TokenHash,
+		&inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetPendingInvitations lists the invitations to the organisation that have
+// not been accepted and have not expired.
+func (m *OrganisationModel) GetPendingInvitations(id string) ([]Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+invitationColumns+`
+		FROM organisation_invitations
+		WHERE organisation_id = $1 AND accepted_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// GetPendingInvitationByHash returns the usable invitation with the given
+// token hash, or nil if there is none.
+func (m *OrganisationModel) GetPendingInvitationByHash(tokenHash []byte) (*Invitation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT `+invitationColumns+`
+		FROM organisation_invitations
+		WHERE token_hash = $1 AND accepted_at IS NULL AND expires_at > CURRENT_TIMESTAMP`,
+		tokenHash,
+	)
+
+	inv, err := scanInvitation(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+// AcceptInvitation adds the user to the invitation's organisation and marks
+// the invitation used. Users who are already members keep their role.
+func (m *OrganisationModel) AcceptInvitation(inv *Invitation, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE organisation_invitations
+		SET accepted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND accepted_at IS NULL`,
+		inv.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO organisation_members (organisation_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organisation_id, user_id) DO NOTHING`,
+		inv.OrganisationId, userId, inv.Role,
+	)
+	if err != nil {
+		return fmt.Errorf("insert member failed: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (m *OrganisationModel) DeleteInvitation(id string, organisationId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`DELETE FROM organisation_invitations WHERE id = $1 AND organisation_id = $2 AND accepted_at IS NULL`,
+		id, organisationId,
+	)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("invitation not found")
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PasskeyModel struct {
+	DB *sql.DB
+}
+
+// Passkey is a WebAuthn credential registered to a user.
+type Passkey struct {
+	Id              string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	UserId          string     `json:"-"`
+	Name            string     `json:"name" example:"MacBook Touch ID"`
+	CredentialId    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-"`
+	AAGUID          []byte     `json:"-"`
+	Transports      []string   `json:"transports" example:"internal,hybrid"`
+	SignCount       uint32     `json:"-"`
+	UserPresent     bool       `json:"-"`
+	UserVerified    bool       `json:"-"`
+	BackupEligible  bool       `json:"-"`
+	BackupState     bool       `json:"backedUp" example:"true"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastUsedAt      *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+const passkeyColumns = `id, user_id, name, credential_id, public_key, attestation_type, aaguid, transports,
+		sign_count, user_present, user_verified, backup_eligible, backup_state, created_at, last_used_at`
+
+func scanPasskey(row interface{ Scan(...interface{}) error }) (*Passkey, error) {
+	var p Passkey
+	var transports pq.StringArray
+	err := row.Scan(
+		&p.Id, &p.UserId, &p.Name, &p.CredentialId, &p.PublicKey, &p.AttestationType, &p.AAGUID, &transports,
+		&p.SignCount, &p.UserPresent, &p.UserVerified, &p.BackupEligible, &p.BackupState, &p.CreatedAt, &p.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.Transports = transports
+	return &p, nil
+}
+
+func (m *PasskeyModel) Insert(p *Passkey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO webauthn_credentials (user_id, name, credential_id, public_key, attestation_type, aaguid,
+			transports, sign_count, user_present, user_verified, backup_eligible, backup_state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		p.UserId, p.Name, p.CredentialId, p.PublicKey, p.AttestationType, p.AAGUID,
+		pq.StringArray(p.Transports), p.SignCount, p.UserPresent, p.UserVerified, p.BackupEligible, p.BackupState,
+	).Scan(&p.Id, &p.CreatedAt)
+}
+
+func (m *PasskeyModel) GetAllForUser(userId string) ([]Passkey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx,
+		`SELECT `+passkeyColumns+` FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	passkeys := []Passkey{}
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		passkeys = append(passkeys, *p)
+	}
+	return passkeys, rows.Err()
+}
+
+// UpdateAfterLogin stores the signature counter and backup state reported by
+// the authenticator during a successful assertion.
+func (m *PasskeyModel) UpdateAfterLogin(credentialId []byte, signCount uint32, backupState bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $1, backup_state = $2, last_used_at = CURRENT_TIMESTAMP
+		WHERE credential_id = $3`
+
+	_, err := m.DB.ExecContext(ctx, query, signCount, backupState, credentialId)
+	return err
+}
+
+func (m *PasskeyModel) Delete(id string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userId)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("passkey not found")
+	}
+	return nil
+}
+
+// InsertSession stores the state of a WebAuthn ceremony until the browser
+// answers the challenge. userId is empty for discoverable logins.
+func (m *PasskeyModel) InsertSession(userId string, data []byte, expiresAt time.Time) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Abandoned ceremonies are cleaned up lazily
+	if _, err := m.DB.ExecContext(ctx, `DELETE FROM webauthn_sessions WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return "", err
+	}
+
+	var uid sql.NullString
+	if userId != "" {
+		uid = sql.NullString{String: userId, Valid: true}
+	}
+
+	var id string
+	err := m.DB.QueryRowContext(ctx,
+		`INSERT INTO webauthn_sessions (user_id, data, expires_at) VALUES ($1, $2, $3) RETURNING id`,
+		uid, data, expiresAt,
+	).Scan(&id)
+	return id, err
+}
+
+// ConsumeSession deletes a ceremony and returns its state, so that every
+// challenge can be answered at most once. It returns nil data if the
+// ceremony does not exist, has expired, or belongs to another user.
+func (m *PasskeyModel) ConsumeSession(id string, userId string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var data []byte
+	var live bool
+	err := m.DB.QueryRowContext(ctx, `
+		DELETE FROM webauthn_sessions
+		WHERE id = $1 AND user_id IS NOT DISTINCT FROM NULLIF($2, '')::uuid
+		RETURNING data, expires_at > CURRENT_TIMESTAMP`,
+		id, userId,
+	).Scan(&data, &live)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !live {
+		return nil, nil
+	}
+	return data, nil
+}
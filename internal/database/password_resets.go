@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+func (m *PasswordResetModel) Insert(userId string, tokenHash []byte, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`
+
+	_, err := m.DB.ExecContext(ctx, query, userId, tokenHash, expiresAt)
+	return err
+}
+
+// Consume marks an unused, unexpired token as used and returns the id of the
+// user it belongs to, or an empty string if no such token exists.
+func (m *PasswordResetModel) Consume(tokenHash []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`
+
+	var userId string
+	err := m.DB.QueryRowContext(ctx, query, tokenHash).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return userId, nil
+}
+
+func (m *PasswordResetModel) DeleteAllForUser(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1`, userId)
+	return err
+}
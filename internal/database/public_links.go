@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PublicLinkModel struct {
+	DB *sql.DB
+}
+
+// PublicLink publishes a list read-only to anyone who has the link. Only a
+// hash of the link token is stored, and of the password if there is one.
+type PublicLink struct {
+	Id           string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ListId       string     `json:"listId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	TokenHash    []byte     `json:"-"`
+	PasswordHash []byte     `json:"-"`
+	HasPassword  bool       `json:"hasPassword" example:"false"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	ViewCount    int64      `json:"viewCount" example:"12"`
+	LastViewedAt *time.Time `json:"lastViewedAt,omitempty"`
+	CreatedBy    *string    `json:"createdBy,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+const publicLinkColumns = `id, list_id, token_hash, password_hash, expires_at, view_count, last_viewed_at, created_by, created_at`
+
+func scanPublicLink(row interface{ Scan(...interface{}) error }) (*PublicLink, error) {
+	var l PublicLink
+	err := row.Scan(&l.Id, &l.ListId, &l.TokenHash, &l.PasswordHash, &l.ExpiresAt,
+		&l.ViewCount, &l.LastViewedAt, &l.CreatedBy, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.HasPassword = l.PasswordHash != nil
+	return &l, nil
+}
+
+func (m *PublicLinkModel) Insert(link *PublicLink) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO public_links (list_id, token_hash, password_hash, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	link.HasPassword = link.PasswordHash != nil
+	return m.DB.QueryRowContext(ctx, query,
+		link.ListId, link.TokenHash, link.PasswordHash, link.ExpiresAt, link.CreatedBy,
+	).Scan(&link.Id, &link.CreatedAt)
+}
+
+// GetForList lists the list's links that have not been revoked.
+func (m *PublicLinkModel) GetForList(listId string) ([]PublicLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+publicLinkColumns+`
+		FROM public_links
+		WHERE list_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`,
+		listId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	links := []PublicLink{}
+	for rows.Next() {
+		l, err := scanPublicLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+// GetActiveByHash returns the link with the given token hash if it has
+// neither been revoked nor expired, or nil otherwise.
+func (m *PublicLinkModel) GetActiveByHash(tokenHash []byte) (*PublicLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT `+publicLinkColumns+`
+		FROM public_links
+		WHERE token_hash = $1 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`,
+		tokenHash,
+	)
+
+	l, err := scanPublicLink(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return l, nil
+}
+
+// RecordView counts one anonymous view of the link.
+func (m *PublicLinkModel) RecordView(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE public_links
+		SET view_count = view_count + 1, last_viewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id,
+	)
+	return err
+}
+
+// Revoke stops the link from working. Revoked links are kept so their
+// view counts are not lost.
+func (m *PublicLinkModel) Revoke(id string, listId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `
+		UPDATE public_links
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND list_id = $2 AND revoked_at IS NULL`,
+		id, listId,
+	)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("link not found")
+	}
+	return nil
+}
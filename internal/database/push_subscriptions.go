@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PushSubscriptionModel struct {
+	DB *sql.DB
+}
+
+// PushSubscription is a browser that asked for web push notifications on
+// behalf of a user.
+type PushSubscription struct {
+	Id        string
+	UserId    string
+	Endpoint  string
+	P256dh    string
+	Auth      string
+	CreatedAt time.Time
+}
+
+// Upsert saves a subscription. A browser that subscribes again, possibly
+// for another user, replaces its earlier subscription.
+func (m *PushSubscriptionModel) Upsert(s *PushSubscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (endpoint) DO UPDATE
+		SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth
+		RETURNING id, created_at`
+
+	return m.DB.QueryRowContext(ctx, query, s.UserId, s.Endpoint, s.P256dh, s.Auth).Scan(&s.Id, &s.CreatedAt)
+}
+
+func (m *PushSubscriptionModel) GetForUser(userId string) ([]PushSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT id, user_id, endpoint, p256dh, auth, created_at
+		FROM push_subscriptions
+		WHERE user_id = $1`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []PushSubscription{}
+	for rows.Next() {
+		var s PushSubscription
+		if err := rows.Scan(&s.Id, &s.UserId, &s.Endpoint, &s.P256dh, &s.Auth, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// Delete removes the user's subscription for a browser. Deleting one that
+// does not exist is not an error.
+func (m *PushSubscriptionModel) Delete(endpoint string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		`DELETE FROM push_subscriptions WHERE endpoint = $1 AND user_id = $2`, endpoint, userId)
+	return err
+}
+
+// DeleteById forgets a subscription the push service no longer accepts.
+func (m *PushSubscriptionModel) DeleteById(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type RecoveryCodeModel struct {
+	DB *sql.DB
+}
+
+// Replace discards any existing recovery codes for the user and stores the
+// given hashes in their place.
+func (m *RecoveryCodeModel) Replace(userId string, codeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userId, hash,
+		)
+		if err != nil {
+			return fmt.Errorf("insert failed: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Consume marks an unused recovery code as used and reports whether it was
+// valid.
+func (m *RecoveryCodeModel) Consume(userId string, codeHash []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userId, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (m *RecoveryCodeModel) DeleteAllForUser(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId)
+	return err
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// Reminder tells a user about a todo at RemindAt, or OffsetMinutes before
+// the todo is due. FireAt is when it goes off, if that is known yet: an
+// offset reminder on a todo whose due date was cleared waits until the todo
+// gets a due date again.
+type Reminder struct {
+	Id            string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	TodoId        string     `json:"todoId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	UserId        string     `json:"-"`
+	RemindAt      *time.Time `json:"remindAt,omitempty" example:"2025-06-01T08:30:00Z"`
+	OffsetMinutes *int       `json:"offsetMinutes,omitempty" example:"30"`
+	FireAt        *time.Time `json:"fireAt,omitempty" example:"2025-06-01T08:30:00Z"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// DueReminder is a reminder the scheduler has claimed, with what it needs
+// to deliver it. Deliverable is false once the user can no longer read
+// the todo or their account is disabled.
+type DueReminder struct {
+	Reminder
+	TodoTitle    string
+	DueAt        *time.Time
+	Completed    bool
+	UserName     string
+	UserEmail    string
+	UserTimeZone string
+	Deliverable  bool
+}
+
+// reminderFireAt is when the reminder r on the todo t goes off.
+const reminderFireAt = `COALESCE(r.remind_at, t.due_at - make_interval(mins => r.offset_minutes))`
+
+const reminderColumns = `r.id, r.todo_id, r.user_id, r.remind_at, r.offset_minutes, ` + reminderFireAt + `, r.sent_at, r.created_at`
+
+func scanReminder(row interface{ Scan(...interface{}) error }) (*Reminder, error) {
+	var r Reminder
+	err := row.Scan(&r.Id, &r.TodoId, &r.UserId, &r.RemindAt, &r.OffsetMinutes, &r.FireAt, &r.SentAt, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *ReminderModel) Insert(r *Reminder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH r AS (
+			INSERT INTO reminders (todo_id, user_id, remind_at, offset_minutes)
+			VALUES ($1, $2, $3, $4)
+			RETURNING *
+		)
+		SELECT ` + reminderColumns + `
+		FROM r
+		JOIN todos t ON t.id = r.todo_id`
+
+	created, err := scanReminder(m.DB.QueryRowContext(ctx, query, r.TodoId, r.UserId, r.RemindAt, r.OffsetMinutes))
+	if err != nil {
+		return err
+	}
+	*r = *created
+	return nil
+}
+
+// GetForTodo returns the user's reminders on a todo, soonest first.
+func (m *ReminderModel) GetForTodo(todoId string, userId string) ([]Reminder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+reminderColumns+`
+		FROM reminders r
+		JOIN todos t ON t.id = r.todo_id
+		WHERE r.todo_id = $1 AND r.user_id = $2
+		ORDER BY `+reminderFireAt+` NULLS LAST, r.created_at`,
+		todoId, userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		reminders = append(reminders, *r)
+	}
+	return reminders, rows.Err()
+}
+
+func (m *ReminderModel) Delete(id string, todoId string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		`DELETE FROM reminders WHERE id = $1 AND todo_id = $2 AND user_id = $3`,
+		id, todoId, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("reminder not found")
+	}
+	return nil
+}
+
+// rescheduleReminders makes the offset reminders on a todo go off again
+// before its new due date, dueAt. Without a due date they wait for one.
+func rescheduleReminders(tx *sql.Tx, todoId string, dueAt *time.Time) error {
+	if dueAt == nil {
+		return nil
+	}
+	_, err := tx.Exec(
+		`UPDATE reminders SET sent_at = NULL, locked_until = NULL
+		 WHERE todo_id = $1 AND offset_minutes IS NOT NULL
+			AND $2::timestamptz - make_interval(mins => offset_minutes) > CURRENT_TIMESTAMP`,
+		todoId, *dueAt)
+	if err != nil {
+		return fmt.Errorf("reschedule reminders failed: %w", err)
+	}
+	return nil
+}
+
+// ClaimDue locks up to limit reminders that have gone off for lease, so
+// that other API processes polling at the same time skip them. Reminders
+// that are not marked sent before the lease ends are claimed again.
+func (m *ReminderModel) ClaimDue(limit int, lease time.Duration) ([]DueReminder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		WITH due AS (
+			SELECT r.id
+			FROM reminders r
+			JOIN todos t ON t.id = r.todo_id
+			WHERE r.sent_at IS NULL
+				AND (r.locked_until IS NULL OR r.locked_until < CURRENT_TIMESTAMP)
+				AND `+reminderFireAt+` <= CURRENT_TIMESTAMP
+			ORDER BY `+reminderFireAt+`
+			LIMIT $1
+			FOR UPDATE OF r SKIP LOCKED
+		), r AS (
+			UPDATE reminders
+			SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			FROM due
+			WHERE reminders.id = due.id
+			RETURNING reminders.*
+		)
+		SELECT `+reminderColumns+`, t.title, t.due_at, t.is_completed, u.name, u.email, u.time_zone,
+			u.disabled_at IS NULL AND `+todoAccess("t", "u.id", false)+`
+		FROM r
+		JOIN todos t ON t.id = r.todo_id
+		JOIN users u ON u.id = r.user_id`,
+		limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	due := []DueReminder{}
+	for rows.Next() {
+		var d DueReminder
+		err := rows.Scan(&d.Id, &d.TodoId, &d.UserId, &d.RemindAt, &d.OffsetMinutes, &d.FireAt, &d.SentAt, &d.CreatedAt,
+			&d.TodoTitle, &d.DueAt, &d.Completed, &d.UserName, &d.UserEmail, &d.UserTimeZone, &d.Deliverable)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+func (m *ReminderModel) MarkSent(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		`UPDATE reminders SET sent_at = CURRENT_TIMESTAMP, locked_until = NULL WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Session is a single login. Its id is the jti of the JWT issued for it.
+type Session struct {
+	Id         string     `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	UserId     string     `json:"-"`
+	Device     string     `json:"device" example:"Chrome on macOS"`
+	UserAgent  string     `json:"userAgent" example:"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) ..."`
+	IPAddress  string     `json:"ipAddress" example:"203.0.113.7"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"-"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+const sessionColumns = `id, user_id, device, user_agent, ip_address, expires_at, revoked_at, last_seen_at, created_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var s Session
+	err := row.Scan(&s.Id, &s.UserId, &s.Device, &s.UserAgent, &s.IPAddress, &s.ExpiresAt, &s.RevokedAt, &s.LastSeenAt, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *SessionModel) Insert(s *Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO sessions (id, user_id, device, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING last_seen_at, created_at`
+
+	return m.DB.QueryRowContext(ctx, query,
+		s.Id, s.UserId, s.Device, s.UserAgent, s.IPAddress, s.ExpiresAt,
+	).Scan(&s.LastSeenAt, &s.CreatedAt)
+}
+
+// GetActive returns the session with the given id if it has neither expired
+// nor been revoked, or nil otherwise.
+func (m *SessionModel) GetActive(id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`,
+		id,
+	)
+
+	s, err := scanSession(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetActiveForUser lists the user's sessions that can still be used, most
+// recently active first.
+func (m *SessionModel) GetActiveForUser(userId string) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch records that the session was used. Like API tokens, writes are
+// limited to one a minute per session.
+func (m *SessionModel) Touch(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE sessions
+		SET last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND last_seen_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+func (m *SessionModel) Revoke(id string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	res, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every active session of the user and returns
+// their ids.
+func (m *SessionModel) RevokeAllForUser(userId string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL
+		RETURNING id`,
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update failed: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type TodoModel struct {
@@ -18,72 +19,283 @@ type Todo struct {
 	Description *string   `json:"description,omitempty" example:"Milk, eggs, and bread"`
 	Completed   bool      `json:"completed" example:"false"`
 	CreatedAt   time.Time `json:"createdAt" example:"2025-05-20T14:28:23Z"`
-	UserId      string    `json:"userId" example:"user-abc-123"`
+	UserId      string    `json:"userId,omitempty" example:"user-abc-123"`
+	ListId      *string   `json:"listId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	AssigneeId  *string   `json:"assigneeId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	// DueAt is the start of the day in the user's time zone for todos due
+	// on a day rather than at a time
+	DueAt        *time.Time `json:"dueAt,omitempty" example:"2025-06-01T09:00:00+02:00"`
+	AllDay       bool       `json:"allDay,omitempty" example:"false"`
+	Recurrence   *string    `json:"recurrence,omitempty" example:"FREQ=MONTHLY;BYMONTHDAY=1"`
+	Tags         []string   `json:"tags" example:"finance"`
+	Priority     *string    `json:"priority,omitempty" example:"high"`
+	CommentCount int        `json:"commentCount" example:"2"`
 }
 
 type TodoCreate struct {
-	Title       string  `json:"title" validate:"required,min=3" example:"Call the doctor"`
-	Description *string `json:"description,omitempty" example:"Schedule annual check-up"`
+	Title       string     `json:"title" validate:"required,min=3" example:"Call the doctor"`
+	Description *string    `json:"description,omitempty" example:"Schedule annual check-up"`
+	ListId      *string    `json:"listId,omitempty" validate:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	AssigneeId  *string    `json:"assigneeId,omitempty" validate:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	DueAt       *time.Time `json:"dueAt,omitempty" example:"2025-06-01T09:00:00+02:00"`
+	AllDay      bool       `json:"allDay,omitempty" example:"false"`
+	Recurrence  *string    `json:"recurrence,omitempty" validate:"omitempty,max=255" example:"FREQ=WEEKLY;BYDAY=MO"`
+	Tags        []string   `json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=50" example:"finance"`
+	Priority    *string    `json:"priority,omitempty" validate:"omitempty,oneof=low medium high urgent" example:"high"`
 }
 
 type TodoPatch struct {
 	Title       *string `json:"title,omitempty" validate:"omitempty,min=3" example:"Call the dentist"`
 	Description *string `json:"description,omitempty" example:"Ask about whitening treatment"`
 	Completed   *bool   `json:"completed,omitempty" example:"true"`
+	// AssigneeId reassigns the todo, or unassigns it when empty
+	AssigneeId *string    `json:"assigneeId,omitempty" validate:"omitempty,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	DueAt      *time.Time `json:"dueAt,omitempty" example:"2025-06-01T09:00:00+02:00"`
+	AllDay     *bool      `json:"allDay,omitempty" example:"false"`
+	// Recurrence and Priority are cleared when empty, and Tags replaces
+	// all of the todo's tags
+	Recurrence *string  `json:"recurrence,omitempty" validate:"omitempty,max=255" example:"FREQ=DAILY"`
+	Tags       []string `json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=50" example:"finance"`
+	Priority   *string  `json:"priority,omitempty" validate:"omitempty,oneof=low medium high urgent" example:"urgent"`
 }
 
-func (m *TodoModel) Get(userId string) ([]Todo, error) {
-	rows, err := m.DB.Query(
-		`SELECT id, title, description, is_completed, created_at, user_id 
-		 FROM todos 
-		 WHERE user_id = $1`, userId)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+// TodoFilter narrows down the todos Get returns.
+type TodoFilter struct {
+	ListId     *string
+	AssigneeId *string
+}
+
+// todoColumns are selected from the todos table aliased as t. The creator
+// is empty once their account has been deleted.
+const todoColumns = `t.id, t.title, t.description, t.is_completed, t.created_at, COALESCE(t.user_id::text, ''), t.list_id, t.assignee_id,
+	t.due_at, t.due_all_day, t.recurrence, t.tags, t.priority,
+	(SELECT COUNT(*) FROM comments c WHERE c.todo_id = t.id)`
+
+// todoFields are the scan destinations for todoColumns.
+func todoFields(t *Todo) []interface{} {
+	return []interface{}{&t.Id, &t.Title, &t.Description, &t.Completed, &t.CreatedAt, &t.UserId, &t.ListId, &t.AssigneeId,
+		&t.DueAt, &t.AllDay, &t.Recurrence, pq.Array(&t.Tags), &t.Priority, &t.CommentCount}
+}
+
+func scanTodo(row interface{ Scan(...interface{}) error }) (*Todo, error) {
+	var t Todo
+	if err := row.Scan(todoFields(&t)...); err != nil {
+		return nil, err
+	}
+	if t.Tags == nil {
+		t.Tags = []string{}
 	}
+	return &t, nil
+}
+
+func scanTodos(rows *sql.Rows) ([]Todo, error) {
 	defer rows.Close()
 
-	var todos []Todo
+	todos := []Todo{}
 	for rows.Next() {
-		var t Todo
-		err := rows.Scan(&t.Id, &t.Title, &t.Description, &t.Completed, &t.CreatedAt, &t.UserId)
+		t, err := scanTodo(rows)
 		if err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
-		todos = append(todos, t)
+		todos = append(todos, *t)
+	}
+	return todos, rows.Err()
+}
+
+// Get returns the user's personal todos, or the todos in filter.ListId if
+// the user can read that list. Filtering by assignee without a list looks
+// through every todo the user can read.
+func (m *TodoModel) Get(userId string, filter TodoFilter) ([]Todo, error) {
+	conditions := []string{}
+	args := []interface{}{userId}
+
+	switch {
+	case filter.ListId != nil:
+		args = append(args, *filter.ListId)
+		conditions = append(conditions, fmt.Sprintf("t.list_id = $%d", len(args)), todoAccess("t", "$1", false))
+	case filter.AssigneeId != nil:
+		conditions = append(conditions, todoAccess("t", "$1", false))
+	default:
+		conditions = append(conditions, "t.list_id IS NULL", "t.user_id = $1")
+	}
+	if filter.AssigneeId != nil {
+		args = append(args, *filter.AssigneeId)
+		conditions = append(conditions, fmt.Sprintf("t.assignee_id = $%d", len(args)))
+	}
+
+	rows, err := m.DB.Query(
+		`SELECT `+todoColumns+`
+		 FROM todos t
+		 WHERE `+stringJoin(conditions, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanTodos(rows)
+}
+
+// GetOne returns the todo if the user can read it, or nil otherwise.
+func (m *TodoModel) GetOne(id string, userId string) (*Todo, error) {
+	row := m.DB.QueryRow(
+		`SELECT `+todoColumns+`
+		 FROM todos t
+		 WHERE t.id = $1 AND `+todoAccess("t", "$2", false), id, userId)
+
+	t, err := scanTodo(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// GetForPublicList returns the todos in a list without any access check,
+// for rendering a list through a public link.
+func (m *TodoModel) GetForPublicList(listId string) ([]Todo, error) {
+	rows, err := m.DB.Query(
+		`SELECT `+todoColumns+`
+		 FROM todos t
+		 WHERE t.list_id = $1
+		 ORDER BY t.created_at`, listId)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
+	return scanTodos(rows)
+}
 
-	return todos, nil
+// CanWrite reports whether the user may change the todo.
+func (m *TodoModel) CanWrite(id string, userId string) (bool, error) {
+	var ok bool
+	err := m.DB.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM todos t WHERE t.id = $1 AND `+todoAccess("t", "$2", true)+`)`,
+		id, userId,
+	).Scan(&ok)
+	return ok, err
 }
 
+// Insert creates a todo for userId, in input.ListId if the user can write
+// to that list. The assignee must be able to read the list, and todos
+// outside any list can only be assigned to their creator.
 func (m *TodoModel) Insert(input *TodoCreate, userId string) (*Todo, error) {
-	id := uuid.New().String()
-	now := time.Now()
-	completed := false
-
-	_, err := m.DB.Exec(
-		`INSERT INTO todos (id, title, description, is_completed, created_at, user_id)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		id, input.Title, input.Description, completed, now, userId,
-	)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if input.ListId != nil {
+		var ok bool
+		err := tx.QueryRow(`SELECT `+listAccess("$1", "$2", true), *input.ListId, userId).Scan(&ok)
+		if err != nil {
+			return nil, fmt.Errorf("access check failed: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("list not found")
+		}
+	}
+
+	if input.AssigneeId != nil {
+		ok := *input.AssigneeId == userId && input.ListId == nil
+		if input.ListId != nil {
+			err := tx.QueryRow(`SELECT `+listAccess("$1", "$2", false), *input.ListId, *input.AssigneeId).Scan(&ok)
+			if err != nil {
+				return nil, fmt.Errorf("access check failed: %w", err)
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid assignee")
+		}
+	}
+
+	tags := input.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	// Read the todo back so it matches what later reads of it return
+	todo, err := scanTodo(tx.QueryRow(
+		`INSERT INTO todos AS t (id, title, description, is_completed, created_at, user_id, list_id, assignee_id,
+			due_at, due_all_day, recurrence, tags, priority)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		 RETURNING `+todoColumns,
+		uuid.New().String(), input.Title, input.Description, false, time.Now(), userId, input.ListId, input.AssigneeId,
+		input.DueAt, input.AllDay && input.DueAt != nil, input.Recurrence, pq.Array(tags), input.Priority,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("insert failed: %w", err)
 	}
 
-	return &Todo{
-		Id:          id,
-		Title:       input.Title,
-		Description: input.Description,
-		Completed:   completed,
-		CreatedAt:   now,
-		UserId:      userId,
-	}, nil
+	version := versionOf(todo)
+	if err := insertTodoEvent(tx, todo.Id, userId, TodoCreated, diffVersions(nil, &version), version, nil); err != nil {
+		return nil, err
+	}
+	if err := pushUndo(tx, userId, undoOperation{TodoId: todo.Id, After: todo}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+	return todo, nil
 }
 
+// Update changes the fields set in patch. A new assignee must be able to
+// read the todo.
 func (m *TodoModel) Update(id string, patch *TodoPatch, userId string) (*Todo, error) {
 	if patch == nil {
 		return nil, fmt.Errorf("nil patch")
 	}
 
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	before, todo, err := m.update(tx, id, patch, userId, TodoUpdated, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := pushUndo(tx, userId, undoOperation{TodoId: id, Before: before, After: todo}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+	return todo, nil
+}
+
+// update applies patch within tx and records the change in the todo's
+// history as action. Nothing is recorded if the tracked fields are the
+// same afterwards. It returns the todo before and after the change.
+func (m *TodoModel) update(tx *sql.Tx, id string, patch *TodoPatch, userId string, action string, revertedEventId *string) (*Todo, *Todo, error) {
+	before, err := scanTodo(tx.QueryRow(
+		`SELECT `+todoColumns+`
+		 FROM todos t
+		 WHERE t.id = $1 AND `+todoAccess("t", "$2", true)+`
+		 FOR UPDATE OF t`, id, userId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("todo not found")
+		}
+		return nil, nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	if patch.AssigneeId != nil && *patch.AssigneeId != "" {
+		var assigneeCanRead bool
+		err := tx.QueryRow(
+			`SELECT `+todoAccess("t", "$2", false)+` FROM todos t WHERE t.id = $1`, id, *patch.AssigneeId,
+		).Scan(&assigneeCanRead)
+		if err != nil {
+			return nil, nil, fmt.Errorf("access check failed: %w", err)
+		}
+		if !assigneeCanRead {
+			return nil, nil, fmt.Errorf("invalid assignee")
+		}
+	}
+
 	setClauses := []string{}
 	args := []interface{}{}
 	argIndex := 1
@@ -103,32 +315,76 @@ func (m *TodoModel) Update(id string, patch *TodoPatch, userId string) (*Todo, e
 		args = append(args, *patch.Completed)
 		argIndex++
 	}
+	if patch.AssigneeId != nil {
+		setClauses = append(setClauses, fmt.Sprintf("assignee_id = $%d", argIndex))
+		if *patch.AssigneeId == "" {
+			args = append(args, nil)
+		} else {
+			args = append(args, *patch.AssigneeId)
+		}
+		argIndex++
+	}
+	if patch.DueAt != nil {
+		setClauses = append(setClauses, fmt.Sprintf("due_at = $%d", argIndex))
+		args = append(args, *patch.DueAt)
+		argIndex++
+	}
+	if patch.AllDay != nil {
+		setClauses = append(setClauses, fmt.Sprintf("due_all_day = $%d", argIndex))
+		args = append(args, *patch.AllDay)
+		argIndex++
+	}
+	if patch.Recurrence != nil {
+		setClauses = append(setClauses, fmt.Sprintf("recurrence = $%d", argIndex))
+		args = append(args, nullIfEmpty(*patch.Recurrence))
+		argIndex++
+	}
+	if patch.Tags != nil {
+		setClauses = append(setClauses, fmt.Sprintf("tags = $%d", argIndex))
+		args = append(args, pq.Array(patch.Tags))
+		argIndex++
+	}
+	if patch.Priority != nil {
+		setClauses = append(setClauses, fmt.Sprintf("priority = $%d", argIndex))
+		args = append(args, nullIfEmpty(*patch.Priority))
+		argIndex++
+	}
 
 	if len(setClauses) == 0 {
-		return nil, fmt.Errorf("no fields to update")
+		return nil, nil, fmt.Errorf("no fields to update")
 	}
 
-	setClauses = append(setClauses, fmt.Sprintf("user_id = $%d", argIndex))
-	args = append(args, userId)
-	argIndex++
-
-	query := fmt.Sprintf(`UPDATE todos SET %s WHERE id = $%d AND user_id = $%d 
-	RETURNING id, title, description, is_completed, created_at, user_id`,
-		joinWithComma(setClauses), argIndex, argIndex+1,
+	query := fmt.Sprintf(`UPDATE todos t SET %s WHERE t.id = $%d
+	RETURNING `+todoColumns,
+		joinWithComma(setClauses), argIndex,
 	)
-	args = append(args, id, userId)
+	args = append(args, id)
 
-	var todo Todo
-	err := m.DB.QueryRow(query, args...).Scan(
-		&todo.Id, &todo.Title, &todo.Description, &todo.Completed, &todo.CreatedAt, &todo.UserId,
-	)
+	todo, err := scanTodo(tx.QueryRow(query, args...))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("todo not found")
+		return nil, nil, fmt.Errorf("update failed: %w", err)
+	}
+
+	if patch.DueAt != nil {
+		if err := rescheduleReminders(tx, id, todo.DueAt); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	from, to := versionOf(before), versionOf(todo)
+	if changes := diffVersions(&from, &to); len(changes) > 0 {
+		if err := insertTodoEvent(tx, id, userId, action, changes, to, revertedEventId); err != nil {
+			return nil, nil, err
 		}
-		return nil, fmt.Errorf("update failed: %w", err)
 	}
-	return &todo, nil
+	return before, todo, nil
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
 }
 
 func joinWithComma(parts []string) string {
@@ -146,17 +402,36 @@ func stringJoin(parts []string, sep string) string {
 	return result
 }
 
+// Delete removes the todo. Its history is kept, ending with the todo as
+// it was when deleted.
 func (m *TodoModel) Delete(id string, userId string) error {
-	res, err := m.DB.Exec("DELETE FROM todos WHERE id = $1 AND user_id = $2", id, userId)
+	tx, err := m.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("delete failed: %w", err)
+		return fmt.Errorf("begin failed: %w", err)
 	}
-	rowsAffected, err := res.RowsAffected()
+	defer tx.Rollback()
+
+	todo, err := scanTodo(tx.QueryRow(
+		`DELETE FROM todos t WHERE t.id = $1 AND `+todoAccess("t", "$2", true)+`
+		 RETURNING `+todoColumns, id, userId,
+	))
 	if err != nil {
-		return fmt.Errorf("rowsAffected failed: %w", err)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("todo not found")
+		}
+		return fmt.Errorf("delete failed: %w", err)
+	}
+
+	version := versionOf(todo)
+	if err := insertTodoEvent(tx, id, userId, TodoDeleted, diffVersions(&version, nil), version, nil); err != nil {
+		return err
+	}
+	if err := pushUndo(tx, userId, undoOperation{TodoId: id, Before: todo}); err != nil {
+		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("todo not found")
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
 	}
 	return nil
 }
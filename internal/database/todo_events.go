@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TodoCreated  = "created"
+	TodoUpdated  = "updated"
+	TodoDeleted  = "deleted"
+	TodoReverted = "reverted"
+)
+
+// TodoEvent is an entry in the history of a todo. Version is the todo as
+// it was after the event, or just before it was deleted.
+type TodoEvent struct {
+	Id              string                 `json:"id" example:"123e4567-e89b-12d3-a456-426614174000"`
+	TodoId          string                 `json:"todoId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ActorId         *string                `json:"actorId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ActorName       string                 `json:"actorName,omitempty" example:"Jane Doe"`
+	Action          string                 `json:"action" example:"updated"`
+	Changes         map[string]FieldChange `json:"changes"`
+	Version         TodoVersion            `json:"version"`
+	RevertedEventId *string                `json:"revertedEventId,omitempty" example:"123e4567-e89b-12d3-a456-426614174000"`
+	CreatedAt       time.Time              `json:"createdAt"`
+}
+
+// FieldChange is the value of a field before and after an event. From is
+// null for created todos and To for deleted ones.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// TodoVersion holds the fields of a todo that are tracked in its history.
+type TodoVersion struct {
+	Title       string  `json:"title" example:"Buy groceries"`
+	Description *string `json:"description,omitempty" example:"Milk, eggs, and bread"`
+	Completed   bool    `json:"completed" example:"false"`
+}
+
+func versionOf(t *Todo) TodoVersion {
+	return TodoVersion{Title: t.Title, Description: t.Description, Completed: t.Completed}
+}
+
+// diffVersions returns the tracked fields that differ between before and
+// after. Either may be nil for a todo that does not exist on that side.
+func diffVersions(before, after *TodoVersion) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	field := func(name string, from, to interface{}, fromOk, toOk bool) {
+		if !fromOk {
+			from = nil
+		}
+		if !toOk {
+			to = nil
+		}
+		if fromOk && toOk && from == to {
+			return
+		}
+		changes[name] = FieldChange{From: from, To: to}
+	}
+
+	var b, a TodoVersion
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+	field("title", b.Title, a.Title, before != nil, after != nil)
+	// A cleared description is stored as either NULL or an empty string
+	field("description", derefString(b.Description), derefString(a.Description), before != nil, after != nil)
+	field("completed", b.Completed, a.Completed, before != nil, after != nil)
+	return changes
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// insertTodoEvent records an event in the same transaction as the change
+// it describes.
+func insertTodoEvent(tx *sql.Tx, todoId string, actorId string, action string, changes map[string]FieldChange, version TodoVersion, revertedEventId *string) error {
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("encode changes failed: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO todo_events (todo_id, actor_id, action, changes, title, description, is_completed, reverted_event_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		todoId, actorId, action, encoded, version.Title, version.Description, version.Completed, revertedEventId,
+	)
+	if err != nil {
+		return fmt.Errorf("insert event failed: %w", err)
+	}
+	return nil
+}
+
+const todoEventColumns = `e.id, e.todo_id, e.actor_id, COALESCE(u.name, ''), e.action, e.changes,
+	e.title, e.description, e.is_completed, e.reverted_event_id, e.created_at`
+
+func scanTodoEvent(row interface{ Scan(...interface{}) error }) (*TodoEvent, error) {
+	var e TodoEvent
+	var changes []byte
+	err := row.Scan(&e.Id, &e.TodoId, &e.ActorId, &e.ActorName, &e.Action, &changes,
+		&e.Version.Title, &e.Version.Description, &e.Version.Completed, &e.RevertedEventId, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(changes, &e.Changes); err != nil {
+		return nil, fmt.Errorf("decode changes failed: %w", err)
+	}
+	return &e, nil
+}
+
+// GetHistory returns a page of the todo's events, newest first, and how
+// many events there are in total.
+func (m *TodoModel) GetHistory(todoId string, limit, offset int) ([]TodoEvent, int, error) {
+	var total int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM todo_events WHERE todo_id = $1`, todoId).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	rows, err := m.DB.Query(
+		`SELECT `+todoEventColumns+`
+		 FROM todo_events e
+		 LEFT JOIN users u ON u.id = e.actor_id
+		 WHERE e.todo_id = $1
+		 ORDER BY e.created_at DESC, e.id
+		 LIMIT $2 OFFSET $3`,
+		todoId, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	events := []TodoEvent{}
+	for rows.Next() {
+		e, err := scanTodoEvent(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
+		}
+		events = append(events, *e)
+	}
+	return events, total, rows.Err()
+}
+
+// Revert restores the title, description and completion of a todo to how
+// they were after eventId, and records that as a new event. It gives
+// "event not found" if the event is not in the todo's history.
+func (m *TodoModel) Revert(id string, eventId string, userId string) (*Todo, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version TodoVersion
+	err = tx.QueryRow(
+		`SELECT title, description, is_completed FROM todo_events
+		 WHERE id = $1 AND todo_id = $2 AND action <> $3`,
+		eventId, id, TodoDeleted,
+	).Scan(&version.Title, &version.Description, &version.Completed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("event not found")
+		}
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	description := derefString(version.Description)
+	patch := &TodoPatch{Title: &version.Title, Description: &description, Completed: &version.Completed}
+	before, todo, err := m.update(tx, id, patch, userId, TodoReverted, &eventId)
+	if err != nil {
+		return nil, err
+	}
+	if err := pushUndo(tx, userId, undoOperation{TodoId: id, Before: before, After: todo}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+	return todo, nil
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// UndoDepth is how many of their latest mutations each user can undo.
+const UndoDepth = 20
+
+type UndoModel struct {
+	DB *sql.DB
+}
+
+// UndoResult describes the todos an undo or redo changed. Todos holds the
+// ones that exist afterwards and Deleted the ids of the ones that don't.
+type UndoResult struct {
+	Todos   []Todo   `json:"todos"`
+	Deleted []string `json:"deleted"`
+}
+
+// undoOperation is one todo as it was before and after a mutation. A nil
+// side means the todo did not exist.
+type undoOperation struct {
+	TodoId string `json:"todoId"`
+	Before *Todo  `json:"before"`
+	After  *Todo  `json:"after"`
+}
+
+// pushUndo records a mutation by userId on their undo stack, in the same
+// transaction as the mutation. Anything the user had undone can no longer
+// be redone afterwards.
+func pushUndo(tx *sql.Tx, userId string, ops ...undoOperation) error {
+	encoded, err := json.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("encode undo failed: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM undo_entries WHERE user_id = $1 AND undone`, userId); err != nil {
+		return fmt.Errorf("clear redo failed: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO undo_entries (user_id, operations) VALUES ($1, $2)`, userId, encoded); err != nil {
+		return fmt.Errorf("insert undo failed: %w", err)
+	}
+	_, err = tx.Exec(
+		`DELETE FROM undo_entries
+		 WHERE user_id = $1 AND id <= (
+			SELECT id FROM undo_entries WHERE user_id = $1 ORDER BY id DESC OFFSET $2 LIMIT 1
+		 )`, userId, UndoDepth)
+	if err != nil {
+		return fmt.Errorf("trim undo failed: %w", err)
+	}
+	return nil
+}
+
+// Undo reverses the user's latest mutation that is younger than ttl and
+// moves it onto the redo stack. It gives "nothing to undo" if there is no
+// such mutation and "undo conflict" if a todo it touched has changed
+// since, or the user can no longer change it.
+func (m *UndoModel) Undo(userId string, ttl time.Duration) (*UndoResult, error) {
+	return m.apply(userId, ttl, false)
+}
+
+// Redo applies the mutation the user undid last again. It fails like Undo,
+// with "nothing to redo" if there is nothing to redo.
+func (m *UndoModel) Redo(userId string, ttl time.Duration) (*UndoResult, error) {
+	return m.apply(userId, ttl, true)
+}
+
+func (m *UndoModel) apply(userId string, ttl time.Duration, redo bool) (*UndoResult, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`DELETE FROM undo_entries WHERE user_id = $1 AND created_at <= CURRENT_TIMESTAMP - make_interval(secs => $2)`,
+		userId, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("expire undo failed: %w", err)
+	}
+
+	// Undone entries are always the newest, so the next redo is the oldest
+	// of them and the next undo the newest of the rest
+	query := `SELECT id, operations FROM undo_entries WHERE user_id = $1 AND NOT undone ORDER BY id DESC LIMIT 1 FOR UPDATE`
+	empty := "nothing to undo"
+	if redo {
+		query = `SELECT id, operations FROM undo_entries WHERE user_id = $1 AND undone ORDER BY id LIMIT 1 FOR UPDATE`
+		empty = "nothing to redo"
+	}
+
+	var entryId int64
+	var encoded []byte
+	if err := tx.QueryRow(query, userId).Scan(&entryId, &encoded); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s", empty)
+		}
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	var ops []undoOperation
+	if err := json.Unmarshal(encoded, &ops); err != nil {
+		return nil, fmt.Errorf("decode undo failed: %w", err)
+	}
+
+	result := &UndoResult{Todos: []Todo{}, Deleted: []string{}}
+	for i := range ops {
+		// Undo the operations of a bulk change in reverse
+		op := ops[len(ops)-1-i]
+		from, to := op.After, op.Before
+		if redo {
+			op = ops[i]
+			from, to = op.Before, op.After
+		}
+
+		todo, err := restoreTodo(tx, op.TodoId, from, to, userId)
+		if err != nil {
+			return nil, err
+		}
+		if todo == nil {
+			result.Deleted = append(result.Deleted, op.TodoId)
+		} else {
+			result.Todos = append(result.Todos, *todo)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE undo_entries SET undone = $2 WHERE id = $1`, entryId, !redo); err != nil {
+		return nil, fmt.Errorf("update undo failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit failed: %w", err)
+	}
+	return result, nil
+}
+
+// restoreTodo changes a todo from the state from to the state to, after
+// checking it is still in the state from and the user can change it. The
+// change is recorded in the todo's history.
+func restoreTodo(tx *sql.Tx, id string, from, to *Todo, userId string) (*Todo, error) {
+	var current *Todo
+	var canWrite bool
+	row := tx.QueryRow(
+		`SELECT `+todoColumns+`, `+todoAccess("t", "$2", true)+`
+		 FROM todos t
+		 WHERE t.id = $1
+		 FOR UPDATE OF t`, id, userId)
+	var t Todo
+	err := row.Scan(append(todoFields(&t), &canWrite)...)
+	switch {
+	case err == nil:
+		current = &t
+	case err != sql.ErrNoRows:
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	if !sameTodo(current, from) {
+		return nil, fmt.Errorf("undo conflict")
+	}
+
+	switch {
+	case current != nil && !canWrite:
+		return nil, fmt.Errorf("undo conflict")
+	case current == nil && to.ListId != nil:
+		if err := tx.QueryRow(`SELECT `+listAccess("$1", "$2", true), *to.ListId, userId).Scan(&canWrite); err != nil {
+			return nil, fmt.Errorf("access check failed: %w", err)
+		}
+	case current == nil:
+		canWrite = to.UserId == userId
+	}
+	if !canWrite {
+		return nil, fmt.Errorf("undo conflict")
+	}
+
+	var restored *Todo
+	action := TodoUpdated
+	switch {
+	case to == nil:
+		action = TodoDeleted
+		_, err = tx.Exec(`DELETE FROM todos WHERE id = $1`, id)
+	case current == nil:
+		// The assignee may have deleted their account in the meantime
+		action = TodoCreated
+		restored, err = scanTodo(tx.QueryRow(
+			`INSERT INTO todos AS t (id, title, description, is_completed, created_at, user_id, list_id, assignee_id,
+				due_at, due_all_day, recurrence, tags, priority)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT id FROM users WHERE id = $8), $9, $10, $11, $12, $13)
+			 RETURNING `+todoColumns,
+			id, to.Title, to.Description, to.Completed, to.CreatedAt, nullIfEmpty(to.UserId), to.ListId, to.AssigneeId,
+			to.DueAt, to.AllDay, to.Recurrence, pq.Array(to.Tags), to.Priority))
+	default:
+		restored, err = scanTodo(tx.QueryRow(
+			`UPDATE todos t
+			 SET title = $2, description = $3, is_completed = $4, assignee_id = (SELECT id FROM users WHERE id = $5),
+				due_at = $6, due_all_day = $7, recurrence = $8, tags = $9, priority = $10
+			 WHERE t.id = $1
+			 RETURNING `+todoColumns,
+			id, to.Title, to.Description, to.Completed, to.AssigneeId,
+			to.DueAt, to.AllDay, to.Recurrence, pq.Array(to.Tags), to.Priority))
+	}
+	if err != nil {
+		// Another undo put the deleted todo back after we looked
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, fmt.Errorf("undo conflict")
+		}
+		return nil, fmt.Errorf("restore failed: %w", err)
+	}
+	if current != nil && restored != nil && !sameTime(current.DueAt, restored.DueAt) {
+		if err := rescheduleReminders(tx, id, restored.DueAt); err != nil {
+			return nil, err
+		}
+	}
+
+	// A deleted todo's history ends with the todo as it was when deleted
+	var before, after *TodoVersion
+	var version TodoVersion
+	if current != nil {
+		v := versionOf(current)
+		before, version = &v, v
+	}
+	if restored != nil {
+		v := versionOf(restored)
+		after, version = &v, v
+	}
+	if changes := diffVersions(before, after); len(changes) > 0 {
+		if err := insertTodoEvent(tx, id, userId, action, changes, version, nil); err != nil {
+			return nil, err
+		}
+	}
+	return restored, nil
+}
+
+// sameTodo reports whether a todo is still in the state an undo entry
+// expects, going by the fields a mutation can change.
+func sameTodo(a, b *Todo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Title == b.Title &&
+		derefString(a.Description) == derefString(b.Description) &&
+		a.Completed == b.Completed &&
+		derefString(a.ListId) == derefString(b.ListId) &&
+		derefString(a.AssigneeId) == derefString(b.AssigneeId) &&
+		sameTime(a.DueAt, b.DueAt) &&
+		a.AllDay == b.AllDay &&
+		derefString(a.Recurrence) == derefString(b.Recurrence) &&
+		strings.Join(a.Tags, ",") == strings.Join(b.Tags, ",") &&
+		derefString(a.Priority) == derefString(b.Priority)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
@@ -3,8 +3,11 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type UserModel struct {
@@ -16,10 +19,45 @@ type User struct {
 	Email     string    `json:"email"`
 	Name      string    `json:"name"`
 	Password  string    `json:"-"`
+	TimeZone  string    `json:"timeZone" example:"Europe/Madrid"`
+	Locale    string    `json:"locale" example:"es"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+	// PendingEmail replaces Email once the user opens the link sent to it
+	PendingEmail    *string    `json:"pendingEmail,omitempty" example:"new@example.com"`
+	TokensRevokedAt *time.Time `json:"-"`
+	TokenVersion    int        `json:"-"`
+	TOTPSecret      *string    `json:"-"`
+	TOTPEnabledAt   *time.Time `json:"totpEnabledAt,omitempty"`
+
+	Role       string     `json:"role" example:"user"`
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+}
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type UserPatch struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,min=1,max=255" example:"Jane Doe"`
+	TimeZone *string `json:"timeZone,omitempty" validate:"omitempty,timezone" example:"Europe/Madrid"`
+	Locale   *string `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag" example:"es"`
 }
 
+// ErrDuplicateEmail is returned when an email address already belongs to
+// another account.
+var ErrDuplicateEmail = errors.New("duplicate email")
+
+// ErrSoleOwner is returned when deleting an account would leave one of its
+// organisations without an owner.
+var ErrSoleOwner = errors.New("sole owner")
+
+const userColumns = `id, email, name, password, time_zone, locale, created_at, updated_at,
+		email_verified_at, pending_email, tokens_revoked_at, token_version, totp_secret, totp_enabled_at, role, disabled_at`
+
 func (m *UserModel) Insert(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -31,13 +69,13 @@ func (m *UserModel) Insert(user *User) error {
 	query := `
 		INSERT INTO users (email, password, name) 
 		VALUES ($1, $2, $3) 
-		RETURNING id, created_at, updated_at`
+		RETURNING id, time_zone, locale, role, created_at, updated_at`
 
 	err := m.DB.QueryRowContext(ctx, query,
 		user.Email,
 		user.Password,
 		user.Name,
-	).Scan(&user.Id, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.Id, &user.TimeZone, &user.Locale, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		fmt.Printf("Error inserting user: %v\n", err)
@@ -58,8 +96,18 @@ func (m *UserModel) getUser(query string, args ...interface{}) (*User, error) {
 		&user.Email,
 		&user.Name,
 		&user.Password,
+		&user.TimeZone,
+		&user.Locale,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.TokensRevokedAt,
+		&user.TokenVersion,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.Role,
+		&user.DisabledAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -73,16 +121,298 @@ func (m *UserModel) getUser(query string, args ...interface{}) (*User, error) {
 
 func (m *UserModel) Get(id string) (*User, error) {
 	query := `
-		SELECT id, email, name, password, created_at, updated_at 
-		FROM users 
+		SELECT ` + userColumns + `
+		FROM users
 		WHERE id = $1`
 	return m.getUser(query, id)
 }
 
 func (m *UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, email, name, password, created_at, updated_at 
-		FROM users 
+		SELECT ` + userColumns + `
+		FROM users
 		WHERE email = $1`
 	return m.getUser(query, email)
 }
+
+func (m *UserModel) MarkEmailVerified(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND email_verified_at IS NULL`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// UpdatePassword stores a new password hash and revokes every token issued
+// before the change. It returns the token version for tokens issued after it.
+func (m *UserModel) UpdatePassword(id string, passwordHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET password = $1, tokens_revoked_at = CURRENT_TIMESTAMP, token_version = token_version + 1
+		WHERE id = $2
+		RETURNING token_version`
+
+	var version int
+	err := m.DB.QueryRowContext(ctx, query, passwordHash, id).Scan(&version)
+	return version, err
+}
+
+func (m *UserModel) Update(id string, patch *UserPatch) (*User, error) {
+	setClauses := []string{}
+	args := []interface{}{}
+	argIndex := 1
+
+	if patch.Name != nil {
+		setClauses = append(setClauses, fmt.Sprintf("name = $%d", argIndex))
+		args = append(args, *patch.Name)
+		argIndex++
+	}
+	if patch.TimeZone != nil {
+		setClauses = append(setClauses, fmt.Sprintf("time_zone = $%d", argIndex))
+		args = append(args, *patch.TimeZone)
+		argIndex++
+	}
+	if patch.Locale != nil {
+		setClauses = append(setClauses, fmt.Sprintf("locale = $%d", argIndex))
+		args = append(args, *patch.Locale)
+		argIndex++
+	}
+
+	if len(setClauses) == 0 {
+		return m.Get(id)
+	}
+
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d RETURNING %s`,
+		joinWithComma(setClauses), argIndex, userColumns,
+	)
+	args = append(args, id)
+
+	return m.getUser(query, args...)
+}
+
+// SetPendingEmail stores the address the user wants to change to. It only
+// replaces their email once ConfirmEmailChange is called for it, and gives
+// ErrDuplicateEmail if another account has the address.
+func (m *UserModel) SetPendingEmail(id string, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET pending_email = $1
+		WHERE id = $2 AND NOT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)`
+
+	res, err := m.DB.ExecContext(ctx, query, email, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDuplicateEmail
+	}
+	return nil
+}
+
+// ConfirmEmailChange makes email, which must still be the user's pending
+// address, their verified email. It gives "pending email not found" if the
+// user has since asked for another address, and ErrDuplicateEmail if an
+// account was created with it in the meantime.
+func (m *UserModel) ConfirmEmailChange(id string, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND pending_email = $2`
+
+	res, err := m.DB.ExecContext(ctx, query, id, email)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("pending email not found")
+	}
+	return nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling also revokes
+// every token issued to it.
+func (m *UserModel) SetDisabled(id string, disabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET disabled_at = NULL
+		WHERE id = $1`
+	if disabled {
+		query = `
+		UPDATE users
+		SET disabled_at = CURRENT_TIMESTAMP, tokens_revoked_at = CURRENT_TIMESTAMP, token_version = token_version + 1
+		WHERE id = $1`
+	}
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rowsAffected failed: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// PromoteToAdmin gives the accounts with the given emails the admin role.
+func (m *UserModel) PromoteToAdmin(emails []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET role = 'admin'
+		WHERE lower(email) = ANY($1) AND role <> 'admin'`
+
+	_, err := m.DB.ExecContext(ctx, query, pq.StringArray(emails))
+	return err
+}
+
+// Delete removes the account with its personal todos. Tokens, personal
+// lists and memberships are removed by cascading foreign keys; todos the
+// user added to shared lists stay. It returns ErrSoleOwner rather than
+// leave an organisation without an owner.
+func (m *UserModel) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locks the owners of every organisation the user owns, as
+	// OrganisationModel.RemoveMember does
+	rows, err := tx.QueryContext(ctx, `
+		SELECT organisation_id FROM organisation_members
+		WHERE role = 'owner' AND organisation_id IN (
+			SELECT organisation_id FROM organisation_members WHERE user_id = $1 AND role = 'owner')
+		FOR UPDATE`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	owners := map[string]int{}
+	for rows.Next() {
+		var orgId string
+		if err := rows.Scan(&orgId); err != nil {
+			rows.Close()
+			return err
+		}
+		owners[orgId]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, count := range owners {
+		if count == 1 {
+			return ErrSoleOwner
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM todos WHERE user_id = $1 AND list_id IS NULL`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetPendingTOTPSecret stores a secret for an enrollment that has not been
+// confirmed yet. It fails to match if TOTP is already enabled.
+func (m *UserModel) SetPendingTOTPSecret(id string, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET totp_secret = $1, totp_last_step = NULL
+		WHERE id = $2 AND totp_enabled_at IS NULL`
+
+	_, err := m.DB.ExecContext(ctx, query, secret, id)
+	return err
+}
+
+func (m *UserModel) EnableTOTP(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET totp_enabled_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND totp_secret IS NOT NULL`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+func (m *UserModel) DisableTOTP(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// UseTOTPStep records step as the last accepted TOTP step. It reports false
+// if that step, or a later one, has already been used.
+func (m *UserModel) UseTOTPStep(id string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+
+	res, err := m.DB.ExecContext(ctx, query, step, id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
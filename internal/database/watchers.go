@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type WatcherModel struct {
+	DB *sql.DB
+}
+
+// Watcher is a user who is notified when a todo changes.
+type Watcher struct {
+	UserId string `json:"userId" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Name   string `json:"name" example:"Jane Doe"`
+	Email  string `json:"email" example:"jane@example.com"`
+}
+
+// Watch subscribes the user to a todo. Watching twice is not an error.
+func (m *WatcherModel) Watch(todoId string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		INSERT INTO todo_watchers (todo_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (todo_id, user_id) DO NOTHING`,
+		todoId, userId,
+	)
+	return err
+}
+
+func (m *WatcherModel) Unwatch(todoId string, userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		`DELETE FROM todo_watchers WHERE todo_id = $1 AND user_id = $2`,
+		todoId, userId,
+	)
+	return err
+}
+
+func (m *WatcherModel) GetForTodo(todoId string) ([]Watcher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email
+		FROM todo_watchers w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.todo_id = $1
+		ORDER BY u.name`,
+		todoId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanWatchers(rows)
+}
+
+// GetRecipients returns the todo's assignee and watchers who can still read
+// it and whose accounts are enabled, each once.
+func (m *WatcherModel) GetRecipients(todoId string) ([]Watcher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email
+		FROM todos t
+		JOIN users u ON u.id = t.assignee_id
+			OR u.id IN (SELECT w.user_id FROM todo_watchers w WHERE w.todo_id = t.id)
+		WHERE t.id = $1 AND u.disabled_at IS NULL AND `+todoAccess("t", "u.id", false),
+		todoId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return scanWatchers(rows)
+}
+
+func scanWatchers(rows *sql.Rows) ([]Watcher, error) {
+	defer rows.Close()
+
+	watchers := []Watcher{}
+	for rows.Next() {
+		var w Watcher
+		if err := rows.Scan(&w.UserId, &w.Name, &w.Email); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		watchers = append(watchers, w)
+	}
+	return watchers, rows.Err()
+}
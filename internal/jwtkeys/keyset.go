@@ -0,0 +1,253 @@
+// Package jwtkeys manages the keys used to sign and verify the API's JWTs.
+//
+// A KeySet has one signing key and any number of verification keys. Every
+// key has a key ID ("kid") that is written into the header of the tokens it
+// signs, so a new signing key can be rolled out while tokens signed by the
+// previous one are still accepted until they expire.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a single signing or verification key.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	// signingKey is nil for keys that can only verify.
+	signingKey interface{}
+	verifyKey  interface{}
+}
+
+// KeySet holds the signing key and every key tokens may be verified with.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// JWK is the public part of a key as published in a JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// NewKeySet returns a KeySet that signs with signing and also verifies with
+// the given additional keys.
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || signing.signingKey == nil {
+		return nil, errors.New("signing key must include a private key")
+	}
+
+	ks := &KeySet{signing: signing, keys: map[string]*Key{signing.ID: signing}}
+	for _, k := range verification {
+		if _, exists := ks.keys[k.ID]; exists {
+			continue
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// NewHMACKey returns a shared-secret HS256 key. HMAC keys are never
+// published in the JWKS.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:         id,
+		Method:     jwt.SigningMethodHS256,
+		signingKey: secret,
+		verifyKey:  secret,
+	}
+}
+
+// LoadKeyFile reads a PEM encoded RSA or Ed25519 key. Private keys (PKCS#1
+// or PKCS#8) can sign and verify; public keys (PKIX) can only verify. The
+// key ID is the RFC 7638 thumbprint of the public key, so it is stable
+// across restarts and replicas without any extra configuration.
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, err := newKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+func newKey(parsed interface{}) (*Key, error) {
+	key := &Key{}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.signingKey = k
+		key.verifyKey = &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+		key.verifyKey = k
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.signingKey = k
+		key.verifyKey = k.Public()
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.verifyKey = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+
+	jwk := key.jwk()
+	key.ID = thumbprint(jwk)
+	return key, nil
+}
+
+// Sign creates a token for claims with the current signing key.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.signingKey)
+}
+
+// Keyfunc finds the verification key for a parsed token. It is meant to be
+// passed to jwt.Parse. Tokens without a kid were signed before key IDs were
+// introduced and are checked against a key using the same algorithm.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	var key *Key
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = ks.keys[kid]
+	} else {
+		key = ks.keyForAlg(token.Method.Alg())
+	}
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	// Never let the token choose the algorithm, or an RSA public key
+	// could be used as an HMAC secret.
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verifyKey, nil
+}
+
+func (ks *KeySet) keyForAlg(alg string) *Key {
+	if ks.signing.Method.Alg() == alg {
+		return ks.signing
+	}
+	for _, k := range ks.keys {
+		if k.Method.Alg() == alg {
+			return k
+		}
+	}
+	return nil
+}
+
+// JWKS returns the public keys in the set. Shared HMAC secrets are left out.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	// The signing key comes first so clients that only look at one key pick it.
+	if jwk := ks.signing.jwk(); jwk.Kty != "" {
+		set.Keys = append(set.Keys, jwk)
+	}
+	for id, k := range ks.keys {
+		if id == ks.signing.ID {
+			continue
+		}
+		if jwk := k.jwk(); jwk.Kty != "" {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (k *Key) jwk() JWK {
+	enc := base64.RawURLEncoding
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			N:   enc.EncodeToString(pub.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(pub),
+		}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint from the required members
+// of the key, in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to an io.Writer instead of delivering them. It is
+// meant for local development and tests, where the links inside the emails
+// can be copied straight out of the log or file.
+type LogMailer struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogMailer(out io.Writer) *LogMailer {
+	return &LogMailer{out: out}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "---- %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
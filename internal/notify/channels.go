@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/janst44/go-react-todo/internal/database"
+	"github.com/janst44/go-react-todo/internal/mailer"
+	"github.com/janst44/go-react-todo/internal/webpush"
+)
+
+// InboxChannel keeps notifications in the user's in-app inbox.
+type InboxChannel struct {
+	Notifications *database.NotificationModel
+}
+
+func (c *InboxChannel) Name() string { return "inbox" }
+
+func (c *InboxChannel) Send(ctx context.Context, n *Notification) error {
+	return c.Notifications.Insert(&database.Notification{
+		UserId: n.UserId,
+		Type:   n.Type,
+		Title:  n.Title,
+		Body:   n.Body,
+		TodoId: n.TodoId,
+		URL:    n.URL,
+	})
+}
+
+// EmailChannel emails notifications to the user.
+type EmailChannel struct {
+	Mailer mailer.Mailer
+}
+
+func (c *EmailChannel) Name() string { return "email" }
+
+func (c *EmailChannel) Send(ctx context.Context, n *Notification) error {
+	return c.Mailer.Send(mailer.Message{
+		To:      n.Email,
+		Subject: n.Title,
+		Body:    fmt.Sprintf("Hi %s,\n\n%s\n\n%s\n", n.Name, n.Body, n.URL),
+	})
+}
+
+// WebPushChannel pushes notifications to every browser the user allowed
+// to show them.
+type WebPushChannel struct {
+	VAPID         *webpush.VAPID
+	Subscriptions *database.PushSubscriptionModel
+	Client        *http.Client
+	// TTL is how long push services hold messages for offline browsers
+	TTL time.Duration
+}
+
+func (c *WebPushChannel) Name() string { return "push" }
+
+// pushPayload is what the service worker receives in its push event.
+type pushPayload struct {
+	Type   string  `json:"type"`
+	Title  string  `json:"title"`
+	Body   string  `json:"body"`
+	TodoId *string `json:"todoId,omitempty"`
+	URL    string  `json:"url,omitempty"`
+}
+
+func (c *WebPushChannel) Send(ctx context.Context, n *Notification) error {
+	subs, err := c.Subscriptions.GetForUser(n.UserId)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(pushPayload{Type: n.Type, Title: n.Title, Body: n.Body, TodoId: n.TodoId, URL: n.URL})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, s := range subs {
+		err := webpush.Send(ctx, c.Client, c.VAPID, webpush.Subscription{Endpoint: s.Endpoint, P256dh: s.P256dh, Auth: s.Auth}, payload, c.TTL)
+		if errors.Is(err, webpush.ErrGone) {
+			err = c.Subscriptions.DeleteById(s.Id)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package notify
+
+import "sync"
+
+// hubBuffer is how many messages a subscriber can fall behind by before
+// further messages to it are dropped
+const hubBuffer = 16
+
+// Hub passes messages on to the subscribers of each user within this
+// process, such as their open notification streams.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan []byte]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[string]map[chan []byte]struct{})}
+}
+
+// Subscribe returns a channel that receives the messages published to the
+// user, and a function that must be called to unsubscribe.
+func (h *Hub) Subscribe(userId string) (<-chan []byte, func()) {
+	ch := make(chan []byte, hubBuffer)
+
+	h.mu.Lock()
+	if h.subs[userId] == nil {
+		h.subs[userId] = make(map[chan []byte]struct{})
+	}
+	h.subs[userId][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs[userId], ch)
+		if len(h.subs[userId]) == 0 {
+			delete(h.subs, userId)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Subscribed reports whether anyone is subscribed to the user.
+func (h *Hub) Subscribed(userId string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[userId]) > 0
+}
+
+// Publish sends msg to the user's subscribers without waiting for them. A
+// subscriber that is too far behind misses it.
+func (h *Hub) Publish(userId string, msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[userId] {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package notify delivers notifications to users over several channels,
+// such as their in-app inbox, email and web push.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Notification types
+const (
+	TypeReminder    = "reminder"
+	TypeAssigned    = "assigned"
+	TypeTodoChanged = "todo_changed"
+	TypeComment     = "comment"
+	TypeMention     = "mention"
+	TypeShareInvite = "share_invite"
+)
+
+// Types lists every type of notification, in the order users are shown
+// them.
+var Types = []string{TypeReminder, TypeAssigned, TypeTodoChanged, TypeComment, TypeMention, TypeShareInvite}
+
+// Notification is something to tell a user about.
+type Notification struct {
+	UserId string
+	Name   string
+	Email  string
+
+	Type  string
+	Title string
+	Body  string
+	// TodoId is the todo the notification is about, if any
+	TodoId *string
+	// URL is where the user can follow up on the notification
+	URL string
+}
+
+// Channel is one way of delivering notifications. Implementations must be
+// safe for concurrent use.
+type Channel interface {
+	// Name identifies the channel, e.g. in errors
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// Preferences tells which channels users turned off for a type of
+// notification.
+type Preferences interface {
+	DisabledChannels(userId string, typ string) ([]string, error)
+}
+
+// Notifier sends each notification over all of its channels that the user
+// has not turned off for its type.
+type Notifier struct {
+	Channels    []Channel
+	Preferences Preferences
+}
+
+func New(prefs Preferences, channels ...Channel) *Notifier {
+	return &Notifier{Channels: channels, Preferences: prefs}
+}
+
+// ChannelNames returns the names of the notifier's channels.
+func (nt *Notifier) ChannelNames() []string {
+	names := make([]string, len(nt.Channels))
+	for i, ch := range nt.Channels {
+		names[i] = ch.Name()
+	}
+	return names
+}
+
+// Notify sends n over every channel the user wants it on. A channel that
+// fails does not keep the others from delivering; their errors are returned
+// together. If the user's preferences cannot be read, n goes out everywhere.
+func (nt *Notifier) Notify(ctx context.Context, n *Notification) error {
+	var errs []error
+	var disabled []string
+	if nt.Preferences != nil {
+		var err error
+		disabled, err = nt.Preferences.DisabledChannels(n.UserId, n.Type)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("preferences: %w", err))
+		}
+	}
+
+	for _, ch := range nt.Channels {
+		if slices.Contains(disabled, ch.Name()) {
+			continue
+		}
+		if err := ch.Send(ctx, n); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,648 @@
+// Package quickadd turns a line of free text such as
+// "Pay rent every 1st of month at 9am #finance !high" into the parts of a
+// todo.
+//
+// Besides the title the text can contain:
+//
+//   - #tags
+//   - a priority: !low, !medium, !high or !urgent, or !4 to !1
+//   - a list: ~groceries, or ~"home chores" for names with spaces
+//   - a due date: today, tomorrow, tonight, friday, next week, in 3 days,
+//     may 5, on 5 may, 5th of may 2026 or 2026-05-05
+//   - a time: 9am, 9:30pm, 17:00, at 9, noon or midnight, or in 2 hours
+//   - a recurrence: daily, every 2 weeks, every weekday, every monday and
+//     thursday, every 1st of the month or every last day of the month
+package quickadd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is what Parse found in the text. Recurrence is an RFC 5545 RRULE
+// and DueAt its first occurrence if no date was given.
+type Result struct {
+	Title      string     `json:"title" example:"Pay rent"`
+	DueAt      *time.Time `json:"dueAt,omitempty" example:"2025-06-01T09:00:00+02:00"`
+	AllDay     bool       `json:"allDay,omitempty" example:"false"`
+	Recurrence string     `json:"recurrence,omitempty" example:"FREQ=MONTHLY;BYMONTHDAY=1"`
+	Tags       []string   `json:"tags" example:"finance"`
+	Priority   string     `json:"priority,omitempty" example:"high"`
+	List       string     `json:"list,omitempty" example:"Household"`
+}
+
+var (
+	tagPattern      = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_-]+)`)
+	priorityPattern = regexp.MustCompile(`(?i)(?:^|\s)!(low|medium|med|normal|high|urgent|[1-4])(?:\s|$)`)
+	listPattern     = regexp.MustCompile(`(?:^|\s)~(?:"([^"]+)"|(\S+))`)
+	clockPattern    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm|a|p)?$`)
+	isoDatePattern  = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	ordinalPattern  = regexp.MustCompile(`^(\d{1,2})(st|nd|rd|th)?$`)
+)
+
+var priorities = map[string]string{
+	"low": "low", "4": "low",
+	"medium": "medium", "med": "medium", "normal": "medium", "3": "medium",
+	"high": "high", "2": "high",
+	"urgent": "urgent", "1": "urgent",
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// Abbreviated weekdays are ordinary words too, as in "sun cream", so they
+// only count after one of dateWords
+var shortWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "jan": time.January, "february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March, "april": time.April, "apr": time.April, "may": time.May,
+	"june": time.June, "jun": time.June, "july": time.July, "jul": time.July, "august": time.August,
+	"aug": time.August, "september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October, "november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+// units are what a recurrence can repeat every so many of
+var units = map[string]bool{"day": true, "week": true, "month": true, "year": true}
+
+// dateWords introduce a date or time and are dropped along with it
+var dateWords = map[string]bool{"on": true, "at": true, "by": true, "due": true, "from": true, "starting": true}
+
+var rruleDays = map[time.Weekday]string{
+	time.Sunday: "SU", time.Monday: "MO", time.Tuesday: "TU", time.Wednesday: "WE",
+	time.Thursday: "TH", time.Friday: "FR", time.Saturday: "SA",
+}
+
+// rule is a recurrence. byMonthDay is -1 for the last day of the month.
+type rule struct {
+	freq       string
+	interval   int
+	byDay      []time.Weekday
+	byMonthDay int
+}
+
+func (r *rule) String() string {
+	s := "FREQ=" + r.freq
+	if r.interval > 1 {
+		s += fmt.Sprintf(";INTERVAL=%d", r.interval)
+	}
+	if len(r.byDay) > 0 {
+		days := make([]string, len(r.byDay))
+		for i, d := range r.byDay {
+			days[i] = rruleDays[d]
+		}
+		s += ";BYDAY=" + strings.Join(days, ",")
+	}
+	if r.byMonthDay != 0 {
+		s += fmt.Sprintf(";BYMONTHDAY=%d", r.byMonthDay)
+	}
+	return s
+}
+
+// matches reports whether the rule can fall on day.
+func (r *rule) matches(day time.Time) bool {
+	if len(r.byDay) > 0 {
+		for _, d := range r.byDay {
+			if day.Weekday() == d {
+				return true
+			}
+		}
+		return false
+	}
+	switch r.byMonthDay {
+	case 0:
+		return true
+	case -1:
+		return day.AddDate(0, 0, 1).Day() == 1
+	default:
+		return day.Day() == r.byMonthDay
+	}
+}
+
+type parser struct {
+	now   time.Time
+	today time.Time
+
+	date  *time.Time
+	clock *[2]int
+	exact *time.Time
+	rule  *rule
+}
+
+// Parse extracts the parts of a todo from text. Dates and times are read
+// in the location of now.
+func Parse(text string, now time.Time) Result {
+	result := Result{Tags: []string{}}
+
+	seen := map[string]bool{}
+	for _, m := range tagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(m[1])
+		if !seen[tag] {
+			seen[tag] = true
+			result.Tags = append(result.Tags, tag)
+		}
+	}
+	text = tagPattern.ReplaceAllString(text, " ")
+
+	for _, m := range priorityPattern.FindAllStringSubmatch(text, -1) {
+		result.Priority = priorities[strings.ToLower(m[1])]
+	}
+	text = priorityPattern.ReplaceAllString(text, " ")
+
+	for _, m := range listPattern.FindAllStringSubmatch(text, -1) {
+		result.List = strings.TrimSpace(m[1] + m[2])
+	}
+	text = listPattern.ReplaceAllString(text, " ")
+
+	p := &parser{
+		now:   now,
+		today: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
+	}
+
+	words := strings.Fields(text)
+	kept := []string{}
+	for i := 0; i < len(words); {
+		prev := ""
+		if len(kept) > 0 {
+			prev = normalize(kept[len(kept)-1])
+		}
+
+		rest := make([]string, 0, len(words)-i)
+		for _, w := range words[i:] {
+			rest = append(rest, normalize(w))
+		}
+
+		n := p.match(rest, prev)
+		if n == 0 {
+			kept = append(kept, words[i])
+			i++
+			continue
+		}
+		if dateWords[prev] {
+			kept = kept[:len(kept)-1]
+		}
+		i += n
+	}
+
+	result.Title = strings.Join(kept, " ")
+	result.DueAt, result.AllDay = p.due()
+	if p.rule != nil {
+		result.Recurrence = p.rule.String()
+	}
+	return result
+}
+
+// normalize lowercases a word and drops punctuation around it.
+func normalize(word string) string {
+	return strings.Trim(strings.ToLower(word), ",.;()")
+}
+
+// match tries each kind of phrase at the start of words and returns how
+// many words the one that matched used, or 0 if none did.
+func (p *parser) match(words []string, prev string) int {
+	for _, m := range []func([]string, string) int{
+		p.matchRecurrence,
+		p.matchRelative,
+		p.matchDate,
+		p.matchDay,
+		p.matchClock,
+	} {
+		if n := m(words, prev); n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func (p *parser) matchRecurrence(words []string, prev string) int {
+	switch words[0] {
+	case "daily":
+		p.rule = &rule{freq: "DAILY"}
+		return 1
+	case "weekly":
+		p.rule = &rule{freq: "WEEKLY"}
+		return 1
+	case "monthly":
+		p.rule = &rule{freq: "MONTHLY"}
+		return 1
+	case "yearly", "annually":
+		p.rule = &rule{freq: "YEARLY"}
+		return 1
+	case "weekdays":
+		p.rule = &rule{freq: "WEEKLY", byDay: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}}
+		return 1
+	case "every":
+	default:
+		return 0
+	}
+
+	n := 1
+	r := &rule{interval: 1}
+	if len(words) > n {
+		if words[n] == "other" {
+			r.interval = 2
+			n++
+		} else if v, err := strconv.Atoi(words[n]); err == nil && v >= 1 && v < 1000 && len(words) > n+1 {
+			// every 1 day, but every 1st is a day of the month
+			if v > 1 || units[strings.TrimSuffix(words[n+1], "s")] {
+				r.interval = v
+				n++
+			}
+		}
+	}
+	if len(words) <= n {
+		return 0
+	}
+
+	switch strings.TrimSuffix(words[n], "s") {
+	case "day":
+		r.freq = "DAILY"
+		n++
+	case "week":
+		r.freq = "WEEKLY"
+		n++
+	case "month":
+		r.freq = "MONTHLY"
+		n++
+	case "year":
+		r.freq = "YEARLY"
+		n++
+	case "weekday":
+		r.freq = "WEEKLY"
+		r.byDay = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+		n++
+	case "weekend":
+		r.freq = "WEEKLY"
+		r.byDay = []time.Weekday{time.Saturday, time.Sunday}
+		n++
+	case "last":
+		// every last day of the month
+		if len(words) < n+2 || words[n+1] != "day" {
+			return 0
+		}
+		r.freq = "MONTHLY"
+		r.byMonthDay = -1
+		n += 2 + monthSuffix(words[n+2:])
+	default:
+		if day, ok := ordinal(words[n]); ok && r.interval == 1 {
+			// every 1st of the month, or every 15th
+			r.freq = "MONTHLY"
+			r.byMonthDay = day
+			n += 1 + monthSuffix(words[n+1:])
+			break
+		}
+
+		// every monday, every mon and thu
+		for n < len(words) {
+			d, ok := weekdays[strings.TrimSuffix(words[n], "s")]
+			if !ok {
+				d, ok = shortWeekdays[words[n]]
+			}
+			if !ok {
+				break
+			}
+			r.byDay = append(r.byDay, d)
+			n++
+			if n+1 < len(words) && words[n] == "and" {
+				if _, ok := weekdays[strings.TrimSuffix(words[n+1], "s")]; ok {
+					n++
+				} else if _, ok := shortWeekdays[words[n+1]]; ok {
+					n++
+				}
+			}
+		}
+		if len(r.byDay) == 0 {
+			return 0
+		}
+		r.freq = "WEEKLY"
+	}
+
+	p.rule = r
+	return n
+}
+
+// monthSuffix returns how many words of "of the month" follow an ordinal.
+func monthSuffix(words []string) int {
+	n := 0
+	if n < len(words) && words[n] == "of" {
+		n++
+	}
+	if n < len(words) && words[n] == "the" {
+		n++
+	}
+	if n < len(words) && words[n] == "month" {
+		return n + 1
+	}
+	return 0
+}
+
+func (p *parser) matchRelative(words []string, prev string) int {
+	switch words[0] {
+	case "in":
+		if len(words) < 3 {
+			return 0
+		}
+		amount, err := strconv.Atoi(words[1])
+		if words[1] == "a" || words[1] == "an" {
+			amount, err = 1, nil
+		}
+		if err != nil || amount < 0 || amount > 1000 {
+			return 0
+		}
+		switch strings.TrimSuffix(words[2], "s") {
+		case "minute", "min":
+			t := p.now.Add(time.Duration(amount) * time.Minute)
+			p.exact = &t
+		case "hour", "hr":
+			t := p.now.Add(time.Duration(amount) * time.Hour)
+			p.exact = &t
+		case "day":
+			p.setDate(p.today.AddDate(0, 0, amount))
+		case "week":
+			p.setDate(p.today.AddDate(0, 0, 7*amount))
+		case "month":
+			p.setDate(p.today.AddDate(0, amount, 0))
+		case "year":
+			p.setDate(p.today.AddDate(amount, 0, 0))
+		default:
+			return 0
+		}
+		return 3
+	case "next":
+		if len(words) < 2 {
+			return 0
+		}
+		switch words[1] {
+		case "week":
+			// The start of next week
+			days := (int(time.Monday) - int(p.today.Weekday()) + 7) % 7
+			if days == 0 {
+				days = 7
+			}
+			p.setDate(p.today.AddDate(0, 0, days))
+		case "month":
+			p.setDate(time.Date(p.today.Year(), p.today.Month()+1, 1, 0, 0, 0, 0, p.today.Location()))
+		case "year":
+			p.setDate(time.Date(p.today.Year()+1, time.January, 1, 0, 0, 0, 0, p.today.Location()))
+		default:
+			d, ok := weekdays[words[1]]
+			if !ok {
+				d, ok = shortWeekdays[words[1]]
+			}
+			if !ok {
+				return 0
+			}
+			p.setDate(p.nextWeekday(d, false))
+		}
+		return 2
+	}
+	return 0
+}
+
+func (p *parser) matchDate(words []string, prev string) int {
+	if m := isoDatePattern.FindStringSubmatch(words[0]); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		if date, ok := p.makeDate(y, time.Month(mo), d); ok {
+			p.setDate(date)
+			return 1
+		}
+		return 0
+	}
+
+	var month time.Month
+	var day, n int
+	if mo, ok := months[words[0]]; ok && len(words) > 1 {
+		// may 5, may 5th
+		d, ok := ordinal(words[1])
+		if !ok {
+			return 0
+		}
+		month, day, n = mo, d, 2
+	} else if d, ok := ordinal(words[0]); ok && len(words) > 1 {
+		// 5 may, 5th of may
+		n = 1
+		of := words[n] == "of" && len(words) > n+1
+		if of {
+			n++
+		}
+		mo, ok := months[words[n]]
+		if !ok {
+			return 0
+		}
+		month, day, n = mo, d, n+1
+
+		// A plain number before a month is often a count, as in "buy 2
+		// march tickets", so it needs "on 5 may", "5th may", "5 of may" or
+		// a year to count as a date
+		if !of && !dateWords[prev] && words[0] == strconv.Itoa(d) && !startsYear(words[n:]) {
+			return 0
+		}
+	} else {
+		return 0
+	}
+
+	year := p.today.Year()
+	explicitYear := false
+	if startsYear(words[n:]) {
+		year, _ = strconv.Atoi(words[n])
+		explicitYear = true
+		n++
+	}
+
+	date, ok := p.makeDate(year, month, day)
+	if !ok {
+		return 0
+	}
+	if !explicitYear && date.Before(p.today) {
+		if date, ok = p.makeDate(year+1, month, day); !ok {
+			return 0
+		}
+	}
+	p.setDate(date)
+	return n
+}
+
+func (p *parser) matchDay(words []string, prev string) int {
+	switch words[0] {
+	case "today":
+		p.setDate(p.today)
+	case "tonight":
+		p.setDate(p.today)
+		p.clock = &[2]int{20, 0}
+	case "tomorrow", "tmrw", "tmr":
+		p.setDate(p.today.AddDate(0, 0, 1))
+	case "weekend":
+		p.setDate(p.nextWeekday(time.Saturday, true))
+	case "this":
+		if len(words) < 2 {
+			return 0
+		}
+		d, ok := weekdays[words[1]]
+		if !ok {
+			d, ok = shortWeekdays[words[1]]
+		}
+		if words[1] == "weekend" {
+			d, ok = time.Saturday, true
+		}
+		if !ok {
+			return 0
+		}
+		p.setDate(p.nextWeekday(d, true))
+		return 2
+	default:
+		d, ok := weekdays[words[0]]
+		if !ok && dateWords[prev] {
+			d, ok = shortWeekdays[words[0]]
+		}
+		if !ok {
+			return 0
+		}
+		p.setDate(p.nextWeekday(d, true))
+	}
+	return 1
+}
+
+func (p *parser) matchClock(words []string, prev string) int {
+	switch words[0] {
+	case "noon", "midday":
+		p.clock = &[2]int{12, 0}
+		return 1
+	case "midnight":
+		p.clock = &[2]int{0, 0}
+		return 1
+	}
+
+	m := clockPattern.FindStringSubmatch(words[0])
+	if m == nil {
+		return 0
+	}
+	n := 1
+	suffix := m[3]
+	if suffix == "" && len(words) > 1 && (words[1] == "am" || words[1] == "pm") {
+		suffix = words[1]
+		n++
+	}
+	// A bare number is only a time after "at", as in "at 9"
+	if suffix == "" && m[2] == "" && prev != "at" {
+		return 0
+	}
+
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	if minute > 59 {
+		return 0
+	}
+	switch {
+	case suffix == "":
+		if hour > 23 {
+			return 0
+		}
+	case hour < 1 || hour > 12:
+		return 0
+	case strings.HasPrefix(suffix, "a"):
+		hour %= 12
+	default:
+		hour = hour%12 + 12
+	}
+
+	p.clock = &[2]int{hour, minute}
+	return n
+}
+
+// startsYear reports whether words start with a year, as in "5 may 2026".
+func startsYear(words []string) bool {
+	if len(words) == 0 || len(words[0]) != 4 {
+		return false
+	}
+	y, err := strconv.Atoi(words[0])
+	return err == nil && y >= 1970
+}
+
+// ordinal reads a day of the month such as 5 or 5th.
+func ordinal(word string) (int, bool) {
+	m := ordinalPattern.FindStringSubmatch(word)
+	if m == nil {
+		return 0, false
+	}
+	day, _ := strconv.Atoi(m[1])
+	return day, day >= 1 && day <= 31
+}
+
+func (p *parser) makeDate(year int, month time.Month, day int) (time.Time, bool) {
+	date := time.Date(year, month, day, 0, 0, 0, 0, p.today.Location())
+	return date, date.Day() == day && date.Month() == month
+}
+
+func (p *parser) setDate(date time.Time) {
+	p.date = &date
+}
+
+// nextWeekday returns the next day that falls on d, which is today if
+// today is d and orToday is set.
+func (p *parser) nextWeekday(d time.Weekday, orToday bool) time.Time {
+	days := (int(d) - int(p.today.Weekday()) + 7) % 7
+	if days == 0 && !orToday {
+		days = 7
+	}
+	return p.today.AddDate(0, 0, days)
+}
+
+// due works out when the todo is due from the parts found, and whether it
+// is due on a day rather than at a time.
+func (p *parser) due() (*time.Time, bool) {
+	if p.exact != nil {
+		return p.exact, false
+	}
+
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), p.clock[0], p.clock[1], 0, 0, day.Location())
+	}
+
+	if p.date != nil {
+		if p.clock == nil {
+			return p.date, true
+		}
+		t := at(*p.date)
+		return &t, false
+	}
+
+	if p.rule != nil {
+		// The first occurrence that is still to come
+		for i := 0; i < 400; i++ {
+			day := p.today.AddDate(0, 0, i)
+			if !p.rule.matches(day) {
+				continue
+			}
+			if p.clock == nil {
+				return &day, true
+			}
+			if t := at(day); t.After(p.now) {
+				return &t, false
+			}
+		}
+		return nil, false
+	}
+
+	if p.clock != nil {
+		t := at(p.today)
+		if !t.After(p.now) {
+			t = at(p.today.AddDate(0, 0, 1))
+		}
+		return &t, false
+	}
+	return nil, false
+}
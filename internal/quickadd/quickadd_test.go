@@ -0,0 +1,170 @@
+package quickadd
+
+import (
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParse(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(year int, month time.Month, day, hour, minute int) *time.Time {
+		d := time.Date(year, month, day, hour, minute, 0, 0, berlin)
+		return &d
+	}
+	utc := func(year int, month time.Month, day, hour, minute int) *time.Time {
+		d := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+		return &d
+	}
+
+	// A Wednesday, the week clocks in Berlin go forward
+	wednesday := at(2025, time.March, 26, 10, 0)
+
+	tests := []struct {
+		name string
+		text string
+		now  *time.Time
+		want Result
+	}{
+		{
+			name: "request example",
+			text: "Pay rent every 1st of month at 9am #finance !high",
+			want: Result{
+				Title:      "Pay rent",
+				DueAt:      at(2025, time.April, 1, 9, 0),
+				Recurrence: "FREQ=MONTHLY;BYMONTHDAY=1",
+				Tags:       []string{"finance"},
+				Priority:   "high",
+			},
+		},
+		{
+			name: "interval of one",
+			text: "every 1 day water plants",
+			want: Result{Title: "water plants", DueAt: at(2025, time.March, 26, 0, 0), AllDay: true, Recurrence: "FREQ=DAILY"},
+		},
+		{
+			name: "interval",
+			text: "Standup every 2 weeks",
+			want: Result{Title: "Standup", DueAt: at(2025, time.March, 26, 0, 0), AllDay: true, Recurrence: "FREQ=WEEKLY;INTERVAL=2"},
+		},
+		{
+			name: "weekdays",
+			text: "Gym every mon and thu at 7pm",
+			want: Result{Title: "Gym", DueAt: at(2025, time.March, 27, 19, 0), Recurrence: "FREQ=WEEKLY;BYDAY=MO,TH"},
+		},
+		{
+			name: "next week",
+			text: "Plan sprint next week",
+			want: Result{Title: "Plan sprint", DueAt: at(2025, time.March, 31, 0, 0), AllDay: true},
+		},
+		{
+			name: "weekday after clocks go forward",
+			text: "Call mum on sunday at 9am",
+			want: Result{Title: "Call mum", DueAt: utc(2025, time.March, 30, 7, 0)},
+		},
+		{
+			name: "hours across clocks going forward",
+			text: "Check oven in 2 hours",
+			now:  at(2025, time.March, 30, 1, 30),
+			want: Result{Title: "Check oven", DueAt: utc(2025, time.March, 30, 2, 30)},
+		},
+		{
+			name: "day after clocks go back",
+			text: "Bins tomorrow at 9am",
+			now:  at(2025, time.October, 25, 12, 0),
+			want: Result{Title: "Bins", DueAt: utc(2025, time.October, 26, 8, 0)},
+		},
+		{
+			name: "last day of the month",
+			text: "Send invoices every last day of the month",
+			want: Result{Title: "Send invoices", DueAt: at(2025, time.March, 31, 0, 0), AllDay: true, Recurrence: "FREQ=MONTHLY;BYMONTHDAY=-1"},
+		},
+		{
+			name: "day of the month skips short months",
+			text: "Backup every 31st",
+			now:  at(2025, time.April, 10, 10, 0),
+			want: Result{Title: "Backup", DueAt: at(2025, time.May, 31, 0, 0), AllDay: true, Recurrence: "FREQ=MONTHLY;BYMONTHDAY=31"},
+		},
+		{
+			name: "invalid day of the month",
+			text: "Report feb 30",
+			want: Result{Title: "Report feb 30"},
+		},
+		{
+			name: "past date rolls over to next year",
+			text: "Dentist on 2 march",
+			want: Result{Title: "Dentist", DueAt: at(2026, time.March, 2, 0, 0), AllDay: true},
+		},
+		{
+			name: "explicit year",
+			text: "Renew passport 5th of may 2027",
+			want: Result{Title: "Renew passport", DueAt: at(2027, time.May, 5, 0, 0), AllDay: true},
+		},
+		{
+			name: "count before a month",
+			text: "Buy 2 march tickets",
+			want: Result{Title: "Buy 2 march tickets"},
+		},
+		{
+			name: "abbreviated weekday as a word",
+			text: "Sun cream",
+			want: Result{Title: "Sun cream"},
+		},
+		{
+			name: "bare number",
+			text: "Read 9 chapters",
+			want: Result{Title: "Read 9 chapters"},
+		},
+		{
+			name: "time already passed today",
+			text: "Call Bob at 9",
+			want: Result{Title: "Call Bob", DueAt: at(2025, time.March, 27, 9, 0)},
+		},
+		{
+			name: "list and tags",
+			text: `Buy milk tomorrow ~"home chores" #Shop #shop !4`,
+			want: Result{Title: "Buy milk", DueAt: at(2025, time.March, 27, 0, 0), AllDay: true, Tags: []string{"shop"}, Priority: "low", List: "home chores"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := wednesday
+			if tt.now != nil {
+				now = tt.now
+			}
+			got := Parse(tt.text, *now)
+
+			if got.Title != tt.want.Title {
+				t.Errorf("title = %q, want %q", got.Title, tt.want.Title)
+			}
+			switch {
+			case got.DueAt == nil && tt.want.DueAt != nil:
+				t.Errorf("dueAt = nil, want %v", tt.want.DueAt)
+			case got.DueAt != nil && tt.want.DueAt == nil:
+				t.Errorf("dueAt = %v, want nil", got.DueAt)
+			case got.DueAt != nil && !got.DueAt.Equal(*tt.want.DueAt):
+				t.Errorf("dueAt = %v, want %v", got.DueAt, tt.want.DueAt)
+			}
+			if got.AllDay != tt.want.AllDay {
+				t.Errorf("allDay = %v, want %v", got.AllDay, tt.want.AllDay)
+			}
+			if got.Recurrence != tt.want.Recurrence {
+				t.Errorf("recurrence = %q, want %q", got.Recurrence, tt.want.Recurrence)
+			}
+			if want := tt.want.Tags; !slices.Equal(got.Tags, want) && (len(got.Tags) > 0 || len(want) > 0) {
+				t.Errorf("tags = %v, want %v", got.Tags, want)
+			}
+			if got.Priority != tt.want.Priority {
+				t.Errorf("priority = %q, want %q", got.Priority, tt.want.Priority)
+			}
+			if got.List != tt.want.List {
+				t.Errorf("list = %q, want %q", got.List, tt.want.List)
+			}
+		})
+	}
+}
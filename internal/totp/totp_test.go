@@ -0,0 +1,103 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890",
+// base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Appendix B lists eight digit codes; six digit codes are their last six
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), Step(time.Unix(59, 0)))
+	if err != nil || got != "287082" {
+		t.Errorf("Code = %s, %v; want 287082", got, err)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		want   bool
+		wantAt int64
+	}{
+		{"current step", code(current), true, current},
+		{"previous step", code(current - Skew), true, current - Skew},
+		{"next step", code(current + Skew), true, current + Skew},
+		{"too old", code(current - Skew - 1), false, 0},
+		{"too new", code(current + Skew + 1), false, 0},
+		{"spaces", code(current)[:3] + " " + code(current)[3:], true, current},
+		{"too short", code(current)[:5], false, 0},
+		{"wrong code", "000000", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.want || step != tt.wantAt {
+				t.Errorf("Validate(%q) = %d, %v; want %d, %v", tt.code, step, ok, tt.wantAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Todo App", "ada@example.com", rfcSecret)
+
+	for _, want := range []string{
+		"otpauth://totp/Todo%20App:ada@example.com?",
+		"secret=" + rfcSecret,
+		"issuer=Todo+App",
+		"digits=6",
+		"period=30",
+	} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI = %s, missing %s", uri, want)
+		}
+	}
+}
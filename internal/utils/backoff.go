@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureTracker counts failed attempts per key, such as a client IP or an
+// account, and locks the key out once it has failed too often. Each further
+// failure doubles the lockout, up to a maximum. Keys that stop failing are
+// forgotten once the maximum lockout has passed.
+type FailureTracker struct {
+	mu          sync.Mutex
+	threshold   int
+	baseLockout time.Duration
+	maxLockout  time.Duration
+	entries     map[string]*failures
+	lastSweep   time.Time
+}
+
+type failures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewFailureTracker locks a key out for baseLockout after threshold failures.
+func NewFailureTracker(threshold int, baseLockout, maxLockout time.Duration) *FailureTracker {
+	return &FailureTracker{
+		threshold:   threshold,
+		baseLockout: baseLockout,
+		maxLockout:  maxLockout,
+		entries:     make(map[string]*failures),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Locked returns how long key remains locked out, or zero if it may try.
+func (ft *FailureTracker) Locked(key string) time.Duration {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	f, ok := ft.entries[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(f.lockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Fail records a failed attempt for key and returns the lockout it caused,
+// or zero if key has not reached the threshold yet.
+func (ft *FailureTracker) Fail(key string) time.Duration {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(ft.lastSweep) > ft.maxLockout {
+		for k, f := range ft.entries {
+			if ft.expired(f, now) {
+				delete(ft.entries, k)
+			}
+		}
+		ft.lastSweep = now
+	}
+
+	f, ok := ft.entries[key]
+	if !ok || ft.expired(f, now) {
+		f = &failures{}
+		ft.entries[key] = f
+	}
+	f.count++
+	f.lastFailure = now
+
+	if f.count < ft.threshold {
+		return 0
+	}
+
+	lockout := ft.baseLockout
+	for i := ft.threshold; i < f.count && lockout < ft.maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > ft.maxLockout {
+		lockout = ft.maxLockout
+	}
+	f.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// Reset forgets the failures of key, for example after a successful login.
+func (ft *FailureTracker) Reset(key string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	delete(ft.entries, key)
+}
+
+func (ft *FailureTracker) expired(f *failures, now time.Time) bool {
+	return now.Sub(f.lastFailure) > ft.maxLockout && now.After(f.lockedUntil)
+}
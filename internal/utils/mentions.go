@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches @handle, where the handle is an email address or
+// the part of one before the @. Mentions inside email addresses in the text
+// are not matched.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([A-Za-z0-9._%+-]+(?:@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)?)`)
+
+// ParseMentions returns the lowercased handles mentioned in text, each once
+// and in the order they first appear.
+func ParseMentions(text string) []string {
+	handles := []string{}
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		// A sentence can end right after a mention
+		handle := strings.ToLower(strings.TrimRight(m[1], "."))
+		if handle == "" || seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+	}
+	return handles
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// KeyedLimiter is an in-memory token bucket per key, such as a client IP or
+// an email address. Buckets that have been idle for a while are dropped.
+type KeyedLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	ttl       time.Duration
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewKeyedLimiter allows burst events per key, refilled at one event every
+// interval.
+func NewKeyedLimiter(interval time.Duration, burst int) *KeyedLimiter {
+	ttl := interval * time.Duration(burst)
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	return &KeyedLimiter{
+		limit:     rate.Every(interval),
+		burst:     burst,
+		ttl:       ttl,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether an event for key may happen now.
+func (l *KeyedLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > l.ttl {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.ttl {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.AllowN(now, 1)
+}
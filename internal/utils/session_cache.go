@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionCache remembers for a short time whether a session is still active,
+// so authenticating a request does not need a database query every time.
+// Sessions revoked by this process are forgotten immediately; revocations by
+// other replicas take effect once the cached entry expires.
+type SessionCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]sessionEntry
+	lastSweep time.Time
+}
+
+type sessionEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+func NewSessionCache(ttl time.Duration) *SessionCache {
+	return &SessionCache{
+		ttl:       ttl,
+		entries:   make(map[string]sessionEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Get reports whether the session is active. ok is false if the answer is
+// not cached or is too old to trust.
+func (sc *SessionCache) Get(id string) (active bool, ok bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	e, found := sc.entries[id]
+	if !found || time.Since(e.checkedAt) > sc.ttl {
+		return false, false
+	}
+	return e.active, true
+}
+
+// Set records whether the session is active.
+func (sc *SessionCache) Set(id string, active bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(sc.lastSweep) > sc.ttl {
+		for k, e := range sc.entries {
+			if now.Sub(e.checkedAt) > sc.ttl {
+				delete(sc.entries, k)
+			}
+		}
+		sc.lastSweep = now
+	}
+
+	sc.entries[id] = sessionEntry{active: active, checkedAt: now}
+}
+
+// Revoke marks the sessions as inactive.
+func (sc *SessionCache) Revoke(ids ...string) {
+	for _, id := range ids {
+		sc.Set(id, false)
+	}
+}
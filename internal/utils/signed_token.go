@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token has expired")
+)
+
+// SignToken returns a URL-safe token carrying payload until expiresAt,
+// authenticated with an HMAC-SHA256 over both.
+func SignToken(secret []byte, payload string, expiresAt time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		strconv.FormatInt(expiresAt.Unix(), 10)
+	return body + "." + base64.RawURLEncoding.EncodeToString(signature(secret, body))
+}
+
+// VerifyToken checks a token produced by SignToken and returns its payload.
+func VerifyToken(secret []byte, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrTokenInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrTokenInvalid
+	}
+	if !hmac.Equal(sig, signature(secret, parts[0]+"."+parts[1])) {
+		return "", ErrTokenInvalid
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrTokenInvalid
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", ErrTokenExpired
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrTokenInvalid
+	}
+	return string(payload), nil
+}
+
+func signature(secret []byte, body string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -1,17 +1,128 @@
 package utils
 
 import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
 )
 
 type CustomValidator struct {
 	validator *validator.Validate
+	uni       *ut.UniversalTranslator
+}
+
+// FieldError is a single failed validation rule, keyed by the JSON name of
+// the offending field.
+type FieldError struct {
+	Field   string
+	Message string
 }
 
 func NewValidator() *CustomValidator {
-	return &CustomValidator{validator: validator.New()}
+	v := validator.New()
+
+	// Report fields by their JSON names so clients can match errors to inputs.
+	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return fld.Name
+		}
+		return name
+	})
+
+	english := en.New()
+	uni := ut.New(english, english, es.New())
+
+	enTrans, _ := uni.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		panic(err)
+	}
+	esTrans, _ := uni.GetTranslator("es")
+	if err := es_translations.RegisterDefaultTranslations(v, esTrans); err != nil {
+		panic(err)
+	}
+
+	return &CustomValidator{validator: v, uni: uni}
 }
 
 func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.validator.Struct(i)
 }
+
+// TranslateErrors converts a validation error into per-field messages in the
+// best language matching the given Accept-Language header. It returns false
+// if err is not a validation error.
+func (cv *CustomValidator) TranslateErrors(err error, acceptLanguage string) ([]FieldError, bool) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil, false
+	}
+
+	trans, _ := cv.uni.FindTranslator(parseAcceptLanguage(acceptLanguage)...)
+
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   fe.Field(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return fieldErrors, true
+}
+
+// parseAcceptLanguage returns the locales listed in an Accept-Language header
+// ordered by preference. Regional tags such as "es-MX" are followed by their
+// base language so they still match a generic translator.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if value, ok := strings.CutPrefix(param, "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		// q=0 means the language is not acceptable at all
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	locales := make([]string, 0, len(tags)*2)
+	for _, t := range tags {
+		locale := strings.ReplaceAll(t.tag, "-", "_")
+		locales = append(locales, locale)
+		if base, _, found := strings.Cut(locale, "_"); found {
+			locales = append(locales, base)
+		}
+	}
+	return locales
+}
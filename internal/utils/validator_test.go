@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"es", []string{"es"}},
+		{"es-MX, en;q=0.8", []string{"es_MX", "es", "en"}},
+		{"en;q=0.5, de;q=0.9, *", []string{"de", "en"}},
+		{"es;q=0, en", []string{"en"}},
+		{"es-MX;q=0.0, fr;q=0.3", []string{"fr"}},
+	}
+
+	for _, tt := range tests {
+		if got := parseAcceptLanguage(tt.header); !slices.Equal(got, tt.want) {
+			t.Errorf("parseAcceptLanguage(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package webpush sends Web Push messages (RFC 8030) with payloads
+// encrypted as in RFC 8291, identifying the sender with VAPID (RFC 8292).
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrGone is returned when the push service no longer accepts messages for
+// a subscription, which should then be forgotten.
+var ErrGone = errors.New("webpush: subscription gone")
+
+// ErrForbiddenAddress is returned when a push endpoint resolves to an
+// address that is not on the public internet.
+var ErrForbiddenAddress = errors.New("webpush: endpoint address not allowed")
+
+// recordSize is the record size advertised in the encrypted payload. Every
+// message fits in a single record.
+const recordSize = 4096
+
+// Subscription is what the browser's PushManager hands out: the endpoint
+// to post messages to and the keys to encrypt them with, base64url encoded.
+type Subscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// VAPID holds the application server's key pair and contact address.
+type VAPID struct {
+	// PublicKey is the uncompressed public key, base64url encoded. Browsers
+	// need it as the applicationServerKey when subscribing.
+	PublicKey string
+	Subject   string
+
+	key *ecdsa.PrivateKey
+}
+
+// NewVAPID loads a VAPID key pair from its base64url encoded private key,
+// as generated by e.g. `npx web-push generate-vapid-keys`. The subject is
+// a mailto: or https: URL push services can use to contact the sender.
+func NewVAPID(privateKey string, subject string) (*VAPID, error) {
+	raw, err := decodeKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid private key: %w", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid private key: %w", err)
+	}
+
+	pub := priv.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+
+	return &VAPID{
+		PublicKey: base64.RawURLEncoding.EncodeToString(pub),
+		Subject:   subject,
+		key:       key,
+	}, nil
+}
+
+// authorization returns the Authorization header for a push service.
+func (v *VAPID) authorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": v.Subject,
+	}).SignedString(v.key)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + v.PublicKey, nil
+}
+
+// NewClient returns an HTTP client for talking to push services. Endpoints
+// come from browsers, so it refuses to connect to loopback, private,
+// link-local and other addresses that are not on the public internet,
+// whatever the endpoint's host name resolves to.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !publicAddr(ip.Unmap()) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 4,
+		},
+	}
+}
+
+// sharedAddressSpace is used for carrier-grade NAT
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// Send delivers payload to the subscription. The push service keeps the
+// message for up to ttl while the browser is offline.
+func Send(ctx context.Context, client *http.Client, vapid *VAPID, sub Subscription, payload []byte, ttl time.Duration) error {
+	uaPublic, err := decodeKey(sub.P256dh)
+	if err != nil {
+		return fmt.Errorf("webpush: invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeKey(sub.Auth)
+	if err != nil {
+		return fmt.Errorf("webpush: invalid auth secret: %w", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	body, err := encrypt(payload, uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := vapid.authorization(sub.Endpoint)
+	if err != nil {
+		return fmt.Errorf("webpush: signing failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("webpush: push service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// encrypt builds an aes128gcm message body for the user agent's key as in
+// RFC 8291, using the given ephemeral key and salt.
+func encrypt(plaintext, uaPublic, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("webpush: invalid p256dh key: %w", err)
+	}
+	ecdhSecret, err := asPrivate.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	prkKey, err := hkdf.Extract(sha256.New, ecdhSecret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext)+1+gcm.Overhead() > recordSize {
+		return nil, fmt.Errorf("webpush: payload too large")
+	}
+
+	// The header is the salt, the record size and the sender's public key
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 marks the last (and only) record
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(trimPadding(s))
+}
+
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// TestEncryptRFC8291 checks encrypt against the example in RFC 8291,
+// Appendix A.
+func TestEncryptRFC8291(t *testing.T) {
+	decode := func(s string) []byte {
+		t.Helper()
+		b, err := decodeKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	asPrivate, err := ecdh.P256().NewPrivateKey(decode("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uaPublic := decode("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	authSecret := decode("BTBZMqHH6r4Tts7J_aSIgg")
+	salt := decode("DGv6ra1nlYgDCS1FRnbzlw")
+
+	body, err := encrypt([]byte("When I grow up, I want to be a watermelon"), uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := base64.RawURLEncoding.EncodeToString(body); got != want {
+		t.Errorf("encrypt = %s, want %s", got, want)
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	client := NewClient(time.Second)
+	for _, url := range []string{srv.URL, "http://[::1]:9/", "http://169.254.169.254/", "http://10.0.0.5/"} {
+		_, err := client.Get(url)
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("GET %s: err = %v, want ErrForbiddenAddress", url, err)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"142.250.74.106": true,
+		"2a00:1450::1":   true,
+		"127.0.0.1":      false,
+		"10.1.2.3":       false,
+		"172.16.0.1":     false,
+		"192.168.1.1":    false,
+		"100.64.0.1":     false,
+		"169.254.0.1":    false,
+		"0.0.0.0":        false,
+		"fd00::1":        false,
+		"fe80::1":        false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
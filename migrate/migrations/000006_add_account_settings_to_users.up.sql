@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT 'en';
+
+-- Deleting an account removes its todos
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_user_id_fkey;
+ALTER TABLE todos
+ADD CONSTRAINT todos_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_user_id_fkey;
+ALTER TABLE todos
+ADD CONSTRAINT todos_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE users
+DROP COLUMN locale,
+DROP COLUMN time_zone;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS login_failures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(255) NOT NULL,
+    user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    reason VARCHAR(32) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_email ON login_failures(email);
+CREATE INDEX IF NOT EXISTS idx_login_failures_created_at ON login_failures(created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_failures;
+-- +goose StatementEnd
@@ -0,0 +1,74 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS organisations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS organisation_members (
+    organisation_id UUID NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'guest')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organisation_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organisation_members_user_id ON organisation_members(user_id);
+
+CREATE TABLE IF NOT EXISTS organisation_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organisation_id UUID NOT NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('admin', 'member', 'guest')),
+    token_hash BYTEA NOT NULL UNIQUE,
+    invited_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_organisation_invitations_organisation_id ON organisation_invitations(organisation_id);
+
+-- A list belongs either to one user or to an organisation
+CREATE TABLE IF NOT EXISTS lists (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organisation_id UUID NULL REFERENCES organisations(id) ON DELETE CASCADE,
+    owner_id UUID NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((organisation_id IS NULL) <> (owner_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_lists_organisation_id ON lists(organisation_id);
+CREATE INDEX IF NOT EXISTS idx_lists_owner_id ON lists(owner_id);
+
+ALTER TABLE todos
+ADD COLUMN list_id UUID NULL REFERENCES lists(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_todos_list_id ON todos(list_id);
+
+-- Todos in shared lists outlive the account that created them. Personal
+-- todos are removed together with the account by UserModel.Delete.
+ALTER TABLE todos ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_user_id_fkey;
+ALTER TABLE todos
+ADD CONSTRAINT todos_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM todos WHERE user_id IS NULL;
+ALTER TABLE todos DROP CONSTRAINT IF EXISTS todos_user_id_fkey;
+ALTER TABLE todos
+ADD CONSTRAINT todos_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE todos ALTER COLUMN user_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_todos_list_id;
+ALTER TABLE todos DROP COLUMN list_id;
+
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS organisation_invitations;
+DROP TABLE IF EXISTS organisation_members;
+DROP TABLE IF EXISTS organisations;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE todos
+ADD COLUMN assignee_id UUID NULL REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_todos_assignee_id ON todos(assignee_id);
+
+CREATE TABLE IF NOT EXISTS todo_watchers (
+    todo_id UUID NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (todo_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_watchers_user_id ON todo_watchers(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS todo_watchers;
+
+ALTER TABLE todos
+DROP COLUMN IF EXISTS assignee_id;
+-- +goose StatementEnd
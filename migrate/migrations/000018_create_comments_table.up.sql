@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS comments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    todo_id UUID NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    author_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    edited_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_todo_id_created_at ON comments(todo_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS comments;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a todo only detaches its attachments; the API removes the
+-- stored files of detached attachments and then their rows
+CREATE TABLE IF NOT EXISTS attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    todo_id UUID NULL REFERENCES todos(id) ON DELETE SET NULL,
+    uploader_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 BYTEA NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_todo_id ON attachments(todo_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_detached ON attachments(created_at) WHERE todo_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS attachments;
+-- +goose StatementEnd
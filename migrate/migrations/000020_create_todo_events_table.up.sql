@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- todo_id has no foreign key so the history of a todo outlives it. The
+-- title, description and is_completed columns hold the todo as it was after
+-- the event, or just before it was deleted
+CREATE TABLE IF NOT EXISTS todo_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    todo_id UUID NOT NULL,
+    actor_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('created', 'updated', 'deleted', 'reverted')),
+    changes JSONB NOT NULL DEFAULT '{}',
+    title VARCHAR(255) NOT NULL,
+    description TEXT NULL,
+    is_completed BOOLEAN NOT NULL,
+    reverted_event_id UUID NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_events_todo_id ON todo_events(todo_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS todo_events;
+-- +goose StatementEnd
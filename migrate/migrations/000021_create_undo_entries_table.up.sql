@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Each entry is one mutation by the user, stored as the state of every
+-- todo it touched before and after. Undone entries form the redo stack
+CREATE TABLE IF NOT EXISTS undo_entries (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    operations JSONB NOT NULL,
+    undone BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_undo_entries_user_id ON undo_entries(user_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS undo_entries;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+-- recurrence is an RFC 5545 RRULE such as FREQ=MONTHLY;BYMONTHDAY=1. Todos
+-- due on a day rather than at a time have due_at at the start of that day
+-- in the user's time zone and due_all_day set
+ALTER TABLE todos
+    ADD COLUMN IF NOT EXISTS due_at TIMESTAMP WITH TIME ZONE NULL,
+    ADD COLUMN IF NOT EXISTS due_all_day BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS recurrence VARCHAR(255) NULL,
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS priority VARCHAR(10) NULL CHECK (priority IN ('low', 'medium', 'high', 'urgent'));
+
+CREATE INDEX IF NOT EXISTS idx_todos_due_at ON todos(due_at) WHERE due_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_todos_tags ON todos USING GIN (tags);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_todos_tags;
+DROP INDEX IF EXISTS idx_todos_due_at;
+ALTER TABLE todos
+    DROP COLUMN IF EXISTS priority,
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS recurrence,
+    DROP COLUMN IF EXISTS due_all_day,
+    DROP COLUMN IF EXISTS due_at;
+-- +goose StatementEnd
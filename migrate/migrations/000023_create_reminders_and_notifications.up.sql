@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A reminder fires at remind_at, or offset_minutes before its todo is due.
+-- The scheduler claims due reminders by pushing locked_until forward, so a
+-- reminder whose delivery was cut short is picked up again once that passes
+CREATE TABLE IF NOT EXISTS reminders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    todo_id UUID NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    remind_at TIMESTAMP WITH TIME ZONE NULL,
+    offset_minutes INTEGER NULL CHECK (offset_minutes >= 0),
+    locked_until TIMESTAMP WITH TIME ZONE NULL,
+    sent_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((remind_at IS NULL) <> (offset_minutes IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_todo_id ON reminders(todo_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_pending ON reminders(remind_at) WHERE sent_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user_id ON push_subscriptions(user_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    todo_id UUID NULL REFERENCES todos(id) ON DELETE SET NULL,
+    read_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS push_subscriptions;
+DROP TABLE IF EXISTS reminders;
+-- +goose StatementEnd
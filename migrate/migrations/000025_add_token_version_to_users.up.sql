@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every JWT and login challenge carries the version it was issued at;
+-- bumping it revokes them all, however recently they were issued
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;
+-- +goose StatementEnd
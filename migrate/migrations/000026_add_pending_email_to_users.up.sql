@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A new address waits here until the link sent to it is opened
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255) NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
+-- +goose StatementEnd